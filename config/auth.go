@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// What users with an unverified email address may do, set with
+// EMAIL_VERIFICATION_POLICY.
+const (
+	// EmailVerificationOff does not restrict unverified users at all.
+	EmailVerificationOff = "off"
+	// EmailVerificationRestricted lets unverified users log in but blocks
+	// routes guarded by middleware.RequireVerifiedEmail. This is the default.
+	EmailVerificationRestricted = "restricted"
+	// EmailVerificationStrict refuses to log unverified users in.
+	EmailVerificationStrict = "strict"
+)
+
+func EmailVerificationPolicy() string {
+	switch policy := strings.ToLower(os.Getenv("EMAIL_VERIFICATION_POLICY")); policy {
+	case EmailVerificationOff, EmailVerificationStrict:
+		return policy
+	default:
+		return EmailVerificationRestricted
+	}
+}
+
+// MagicLinkEnabled reports whether passwordless login links are switched on
+// with MAGIC_LINK_ENABLED=true. They are off by default.
+func MagicLinkEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("MAGIC_LINK_ENABLED"))
+	return enabled
+}
+
+// ImpersonationReadOnly reports whether impersonation tokens are limited to
+// safe (GET, HEAD, OPTIONS) requests. Set IMPERSONATION_READ_ONLY=false to
+// allow writes; it is on by default.
+func ImpersonationReadOnly() bool {
+	readOnly, err := strconv.ParseBool(os.Getenv("IMPERSONATION_READ_ONLY"))
+	return err != nil || readOnly
+}
+
+// How clients authenticate, set with AUTH_MODE.
+const (
+	// AuthModeHeader returns tokens in the response body for use in the
+	// Authorization header. This is the default.
+	AuthModeHeader = "header"
+	// AuthModeCookie keeps tokens in HttpOnly cookies only, protected by a
+	// double-submit CSRF token. Meant for the browser frontend.
+	AuthModeCookie = "cookie"
+	// AuthModeBoth sets the cookies and also returns the tokens in the body.
+	AuthModeBoth = "both"
+)
+
+func AuthMode() string {
+	switch mode := strings.ToLower(os.Getenv("AUTH_MODE")); mode {
+	case AuthModeCookie, AuthModeBoth:
+		return mode
+	default:
+		return AuthModeHeader
+	}
+}
+
+// CookieAuthEnabled reports whether login sets auth cookies and RequireAuth
+// accepts them.
+func CookieAuthEnabled() bool {
+	return AuthMode() != AuthModeHeader
+}
+
+// Who may use /register, set with REGISTRATION_MODE.
+const (
+	// RegistrationOpen lets anyone register. This is the default.
+	RegistrationOpen = "open"
+	// RegistrationInvite requires a valid invitation token.
+	RegistrationInvite = "invite"
+	// RegistrationClosed disables /register; administrators create accounts.
+	RegistrationClosed = "closed"
+)
+
+func RegistrationMode() string {
+	switch mode := strings.ToLower(os.Getenv("REGISTRATION_MODE")); mode {
+	case RegistrationInvite, "invite-only", "invite_only":
+		return RegistrationInvite
+	case RegistrationClosed:
+		return RegistrationClosed
+	default:
+		return RegistrationOpen
+	}
+}
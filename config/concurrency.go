@@ -0,0 +1,66 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConcurrencyLimitConfig configures a middleware.ConcurrencyLimit. The limit
+// on in-flight requests starts at Max and moves between Min and Max with the
+// observed latency.
+type ConcurrencyLimitConfig struct {
+	Name string
+	// Max is the highest number of requests handled at once. 0 disables the
+	// limiter.
+	Max int
+	Min int
+	// QueueSize is how many requests may wait for a free slot, for at most
+	// QueueTimeout, before being shed.
+	QueueSize    int
+	QueueTimeout time.Duration
+	// TargetLatency is the response time above which the limit is lowered.
+	TargetLatency time.Duration
+}
+
+var defaultConcurrencyLimits = map[string]ConcurrencyLimitConfig{
+	"global": {Name: "global", Max: 256, Min: 16, QueueSize: 128, QueueTimeout: 200 * time.Millisecond, TargetLatency: 500 * time.Millisecond},
+	"api":    {Name: "api", Max: 128, Min: 8, QueueSize: 64, QueueTimeout: 200 * time.Millisecond, TargetLatency: 500 * time.Millisecond},
+}
+
+// ConcurrencyLimit returns the configuration of the named limiter, read from
+// CONCURRENCY_<NAME>_MAX, _MIN, _QUEUE_SIZE, _QUEUE_TIMEOUT and
+// _TARGET_LATENCY. Unset settings keep the built-in values; invalid ones stop
+// the server at startup.
+func ConcurrencyLimit(name string) ConcurrencyLimitConfig {
+	cfg, ok := defaultConcurrencyLimits[name]
+	if !ok {
+		cfg = defaultConcurrencyLimits["api"]
+		cfg.Name = name
+	}
+	env := func(key string) string {
+		return strings.TrimSpace(os.Getenv("CONCURRENCY_" + strings.ToUpper(name) + "_" + key))
+	}
+	for key, target := range map[string]*int{"MAX": &cfg.Max, "MIN": &cfg.Min, "QUEUE_SIZE": &cfg.QueueSize} {
+		if value := env(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				log.Fatalf("FATAL: Invalid CONCURRENCY_%s_%s %q", strings.ToUpper(name), key, value)
+			}
+			*target = n
+		}
+	}
+	for key, target := range map[string]*time.Duration{"QUEUE_TIMEOUT": &cfg.QueueTimeout, "TARGET_LATENCY": &cfg.TargetLatency} {
+		if value := env(key); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				log.Fatalf("FATAL: Invalid CONCURRENCY_%s_%s %q", strings.ToUpper(name), key, value)
+			}
+			*target = d
+		}
+	}
+	cfg.Min = max(1, min(cfg.Min, cfg.Max))
+	return cfg
+}
@@ -30,6 +30,42 @@ func Connection() {
 	if err != nil {
 		panic(err)
 	}
-	db.AutoMigrate(&models.User{})
+	// ผู้ใช้ที่มีอยู่ก่อนเพิ่มการยืนยันอีเมล ถือว่ายืนยันแล้ว
+	backfillVerified := !db.Migrator().HasColumn(&models.User{}, "email_verified_at")
+	backfillOrganizations := !db.Migrator().HasTable(&models.Organization{})
+	db.AutoMigrate(
+		&models.User{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.Permission{},
+		&models.Role{},
+		&models.RecoveryCode{},
+		&models.SecurityEvent{},
+		&models.ExternalIdentity{},
+		&models.APIKey{},
+		&models.Session{},
+		&models.MagicLinkToken{},
+		&models.AuditLog{},
+		&models.Invitation{},
+		&models.DataExport{},
+		&models.Organization{},
+		&models.Membership{},
+		&models.Product{},
+		&models.APIUsage{},
+	)
+	// SKU เคยเป็น unique ทั้งระบบ ตอนนี้ unique แค่ภายในองค์กร (idx_org_sku)
+	if db.Migrator().HasIndex(&models.Product{}, "idx_products_sku") {
+		if err := db.Migrator().DropIndex(&models.Product{}, "idx_products_sku"); err != nil {
+			log.Printf("ERROR: Failed to drop the global SKU index: %v", err)
+		}
+	}
+	if backfillVerified {
+		db.Model(&models.User{}).Where("email_verified_at IS NULL").Update("email_verified_at", gorm.Expr("created_at"))
+	}
+	seedRBAC(db)
+	if backfillOrganizations {
+		backfillDefaultOrganization(db)
+	}
+	registerTenantScope(db)
 	DB = db
 }
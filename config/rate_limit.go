@@ -0,0 +1,159 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limit algorithms.
+const (
+	// RateLimitSlidingWindow keeps a log of request times and allows Limit
+	// requests in any window of Period. This is the default.
+	RateLimitSlidingWindow = "sliding_window"
+	// RateLimitTokenBucket allows bursts of up to Limit requests and refills
+	// Limit tokens evenly over Period.
+	RateLimitTokenBucket = "token_bucket"
+)
+
+// What a rate limit counter is keyed by. A policy may combine several.
+const (
+	RateLimitKeyIP = "ip"
+	// RateLimitKeyUser uses the authenticated user and falls back to the IP.
+	RateLimitKeyUser = "user"
+	// RateLimitKeyAPIKey uses the API key the request was made with and falls
+	// back to the user, then the IP.
+	RateLimitKeyAPIKey = "api_key"
+	// RateLimitKeyRoute gives every route using the policy its own budget.
+	RateLimitKeyRoute = "route"
+)
+
+// What a policy does when Redis is unavailable or fails.
+const (
+	// RateLimitFailLocal counts requests in memory, per API instance, until
+	// Redis is back. This is the default.
+	RateLimitFailLocal = "local"
+	// RateLimitFailOpen lets every request through.
+	RateLimitFailOpen = "open"
+	// RateLimitFailClosed rejects every request with 503.
+	RateLimitFailClosed = "closed"
+)
+
+// RateLimitPolicy is a named rate limit that can be attached to routes and
+// groups with middleware.RateLimit.
+type RateLimitPolicy struct {
+	Name      string
+	Algorithm string
+	Limit     int64
+	Period    time.Duration
+	Key       []string
+	OnFailure string
+}
+
+// defaultRateLimitPolicies are used unless overridden in the environment.
+var defaultRateLimitPolicies = []RateLimitPolicy{
+	{Name: "default", Algorithm: RateLimitSlidingWindow, Limit: 5, Period: time.Minute, Key: []string{RateLimitKeyIP}, OnFailure: RateLimitFailLocal},
+	{Name: "login", Algorithm: RateLimitSlidingWindow, Limit: 5, Period: time.Minute, Key: []string{RateLimitKeyIP}, OnFailure: RateLimitFailLocal},
+	{Name: "register", Algorithm: RateLimitSlidingWindow, Limit: 5, Period: time.Minute, Key: []string{RateLimitKeyIP}, OnFailure: RateLimitFailLocal},
+	{Name: "password_reset", Algorithm: RateLimitSlidingWindow, Limit: 5, Period: time.Minute, Key: []string{RateLimitKeyIP}, OnFailure: RateLimitFailLocal},
+	{Name: "verify_email", Algorithm: RateLimitSlidingWindow, Limit: 3, Period: 15 * time.Minute, Key: []string{RateLimitKeyIP}, OnFailure: RateLimitFailLocal},
+	{Name: "refresh", Algorithm: RateLimitTokenBucket, Limit: 30, Period: time.Minute, Key: []string{RateLimitKeyIP}, OnFailure: RateLimitFailLocal},
+	{Name: "change_password", Algorithm: RateLimitSlidingWindow, Limit: 5, Period: time.Minute, Key: []string{RateLimitKeyUser}, OnFailure: RateLimitFailLocal},
+	{Name: "api", Algorithm: RateLimitTokenBucket, Limit: 120, Period: time.Minute, Key: []string{RateLimitKeyAPIKey}, OnFailure: RateLimitFailLocal},
+}
+
+var (
+	rateLimitPolicies     map[string]RateLimitPolicy
+	rateLimitPoliciesOnce sync.Once
+)
+
+// RateLimitPolicies returns the policies keyed by name. Policies listed in
+// RATE_LIMIT_POLICIES are read from RATE_LIMIT_<NAME>_ALGORITHM, _LIMIT,
+// _PERIOD, _KEY and _ON_FAILURE; unset settings keep the built-in value of
+// the policy with that name, or of "default" for new policies.
+func RateLimitPolicies() map[string]RateLimitPolicy {
+	rateLimitPoliciesOnce.Do(func() {
+		rateLimitPolicies = map[string]RateLimitPolicy{}
+		for _, policy := range defaultRateLimitPolicies {
+			rateLimitPolicies[policy.Name] = policy
+		}
+		for _, name := range strings.Split(os.Getenv("RATE_LIMIT_POLICIES"), ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			policy, ok := rateLimitPolicies[name]
+			if !ok {
+				policy = rateLimitPolicies["default"]
+				policy.Name = name
+			}
+			rateLimitPolicies[name] = loadRateLimitPolicy(policy)
+		}
+	})
+	return rateLimitPolicies
+}
+
+// RateLimitPolicyByName returns the policy with the given name.
+func RateLimitPolicyByName(name string) (RateLimitPolicy, bool) {
+	policy, ok := RateLimitPolicies()[name]
+	return policy, ok
+}
+
+func loadRateLimitPolicy(policy RateLimitPolicy) RateLimitPolicy {
+	env := func(key string) string {
+		return strings.TrimSpace(os.Getenv("RATE_LIMIT_" + strings.ToUpper(policy.Name) + "_" + key))
+	}
+	if algorithm := strings.ToLower(env("ALGORITHM")); algorithm != "" {
+		if algorithm != RateLimitSlidingWindow && algorithm != RateLimitTokenBucket {
+			log.Fatalf("FATAL: Unknown algorithm %q in rate limit policy %s", algorithm, policy.Name)
+		}
+		policy.Algorithm = algorithm
+	}
+	if value := env("LIMIT"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit <= 0 {
+			log.Fatalf("FATAL: Invalid limit %q in rate limit policy %s", value, policy.Name)
+		}
+		policy.Limit = limit
+	}
+	if value := env("PERIOD"); value != "" {
+		period, err := time.ParseDuration(value)
+		if err != nil || period < time.Millisecond {
+			log.Fatalf("FATAL: Invalid period %q in rate limit policy %s", value, policy.Name)
+		}
+		policy.Period = period
+	}
+	if value := env("KEY"); value != "" {
+		var key []string
+		for _, part := range strings.Split(value, ",") {
+			part = strings.ToLower(strings.TrimSpace(part))
+			switch part {
+			case RateLimitKeyIP, RateLimitKeyUser, RateLimitKeyAPIKey, RateLimitKeyRoute:
+				key = append(key, part)
+			case "":
+			default:
+				log.Fatalf("FATAL: Unknown key %q in rate limit policy %s", part, policy.Name)
+			}
+		}
+		policy.Key = key
+	}
+	if mode := strings.ToLower(env("ON_FAILURE")); mode != "" {
+		if mode != RateLimitFailLocal && mode != RateLimitFailOpen && mode != RateLimitFailClosed {
+			log.Fatalf("FATAL: Unknown failure mode %q in rate limit policy %s", mode, policy.Name)
+		}
+		policy.OnFailure = mode
+	}
+	return policy
+}
+
+// APIQuotas returns how many requests each user, and each API key, may make
+// per UTC day and per calendar month, set with API_QUOTA_DAILY and
+// API_QUOTA_MONTHLY. 0, the default, means unlimited.
+func APIQuotas() (daily, monthly int64) {
+	daily, _ = strconv.ParseInt(os.Getenv("API_QUOTA_DAILY"), 10, 64)
+	monthly, _ = strconv.ParseInt(os.Getenv("API_QUOTA_MONTHLY"), 10, 64)
+	return max(daily, 0), max(monthly, 0)
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadRateLimitPolicy(t *testing.T) {
+	base := RateLimitPolicy{Name: "search", Algorithm: RateLimitSlidingWindow, Limit: 5, Period: time.Minute, Key: []string{RateLimitKeyIP}, OnFailure: RateLimitFailLocal}
+	tests := []struct {
+		name string
+		env  map[string]string
+		want RateLimitPolicy
+	}{
+		{"nothing set keeps the policy", nil, base},
+		{
+			name: "every setting",
+			env: map[string]string{
+				"RATE_LIMIT_SEARCH_ALGORITHM":  "Token_Bucket",
+				"RATE_LIMIT_SEARCH_LIMIT":      "100",
+				"RATE_LIMIT_SEARCH_PERIOD":     "1h",
+				"RATE_LIMIT_SEARCH_KEY":        " user , route,",
+				"RATE_LIMIT_SEARCH_ON_FAILURE": "closed",
+			},
+			want: RateLimitPolicy{Name: "search", Algorithm: RateLimitTokenBucket, Limit: 100, Period: time.Hour, Key: []string{RateLimitKeyUser, RateLimitKeyRoute}, OnFailure: RateLimitFailClosed},
+		},
+		{
+			name: "partly set",
+			env:  map[string]string{"RATE_LIMIT_SEARCH_LIMIT": "20"},
+			want: RateLimitPolicy{Name: "search", Algorithm: RateLimitSlidingWindow, Limit: 20, Period: time.Minute, Key: []string{RateLimitKeyIP}, OnFailure: RateLimitFailLocal},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			if got := loadRateLimitPolicy(base); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("policy = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultRateLimitPolicies(t *testing.T) {
+	names := map[string]bool{}
+	for _, policy := range defaultRateLimitPolicies {
+		if names[policy.Name] {
+			t.Errorf("policy %s is defined twice", policy.Name)
+		}
+		names[policy.Name] = true
+		if policy.Limit <= 0 || policy.Period <= 0 || len(policy.Key) == 0 {
+			t.Errorf("policy %s = %+v, want a limit, a period and a key", policy.Name, policy)
+		}
+	}
+	if !names["default"] {
+		t.Error(`the "default" policy, which new policies start from, is missing`)
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"API/models"
+	"log"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+var defaultPermissions = []models.Permission{
+	{Name: models.PermAll, Description: "Every permission"},
+	{Name: models.PermUsersRead, Description: "List and view users"},
+	{Name: models.PermUsersAdmin, Description: "Manage any user account"},
+	{Name: models.PermProductsRead, Description: "List and view products"},
+	{Name: models.PermProductsWrite, Description: "Create, update and delete products"},
+	{Name: models.PermRolesAdmin, Description: "Manage roles and role assignments"},
+	{Name: models.PermKeysAdmin, Description: "Rotate JWT signing keys"},
+	{Name: models.PermUsersImpersonate, Description: "Act as another user for support"},
+	{Name: models.PermOrgsAdmin, Description: "Create and manage organizations"},
+	{Name: models.PermMembersAdmin, Description: "Manage the members of the current organization"},
+}
+
+var defaultRoles = map[string][]string{
+	models.RoleAdmin:     {models.PermAll},
+	models.RoleUser:      {models.PermUsersRead, models.PermProductsRead},
+	models.RoleOrgAdmin:  {models.PermUsersRead, models.PermMembersAdmin, models.PermProductsRead, models.PermProductsWrite},
+	models.RoleOrgMember: {models.PermUsersRead, models.PermProductsRead},
+}
+
+// seedRBAC creates the built-in permissions and roles when they are missing.
+// Existing roles are left alone so changes made through the API survive restarts.
+func seedRBAC(db *gorm.DB) {
+	for _, p := range defaultPermissions {
+		perm := p
+		if err := db.Where(models.Permission{Name: perm.Name}).FirstOrCreate(&perm).Error; err != nil {
+			log.Printf("ERROR: Failed to seed permission %s: %v", perm.Name, err)
+		}
+	}
+
+	for name, permNames := range defaultRoles {
+		var count int64
+		db.Model(&models.Role{}).Where("name = ?", name).Count(&count)
+		if count > 0 {
+			continue
+		}
+		var perms []models.Permission
+		db.Where("name IN ?", permNames).Find(&perms)
+		role := models.Role{Name: name, Permissions: perms}
+		if err := db.Create(&role).Error; err != nil {
+			log.Printf("ERROR: Failed to seed role %s: %v", name, err)
+		}
+	}
+
+	upgradeOrgAdminRole(db)
+
+	// ADMIN_EMAIL lets the first administrator be bootstrapped without touching the database.
+	if adminEmail := os.Getenv("ADMIN_EMAIL"); adminEmail != "" {
+		db.Model(&models.User{}).Where("email = ?", adminEmail).Update("role", models.RoleAdmin)
+	}
+}
+
+// upgradeOrgAdminRole replaces users:admin with members:admin on an org_admin
+// role seeded by an earlier version. users:admin manages global accounts and
+// is no longer granted through a membership.
+func upgradeOrgAdminRole(db *gorm.DB) {
+	var role models.Role
+	if err := db.Preload("Permissions").Where("name = ?", models.RoleOrgAdmin).First(&role).Error; err != nil {
+		return
+	}
+	var usersAdmin, membersAdmin models.Permission
+	if db.Where("name = ?", models.PermUsersAdmin).First(&usersAdmin).Error != nil ||
+		db.Where("name = ?", models.PermMembersAdmin).First(&membersAdmin).Error != nil {
+		return
+	}
+	for _, p := range role.Permissions {
+		if p.ID == usersAdmin.ID {
+			assoc := db.Model(&role).Association("Permissions")
+			if err := assoc.Delete(&usersAdmin); err != nil {
+				log.Printf("ERROR: Failed to remove %s from role %s: %v", models.PermUsersAdmin, role.Name, err)
+				return
+			}
+			if err := assoc.Append(&membersAdmin); err != nil {
+				log.Printf("ERROR: Failed to add %s to role %s: %v", models.PermMembersAdmin, role.Name, err)
+			}
+			return
+		}
+	}
+}
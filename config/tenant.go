@@ -0,0 +1,124 @@
+package config
+
+import (
+	"API/models"
+	"context"
+	"log"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type tenantContextKey struct{}
+
+// WithTenant returns a context whose GORM queries are limited to the
+// organization. middleware.ResolveTenant puts it on every authenticated
+// request; a tenant of 0 means "no organization" and matches no rows.
+func WithTenant(ctx context.Context, organizationID uint) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, organizationID)
+}
+
+// TenantFromContext returns the organization set by WithTenant.
+func TenantFromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	id, ok := ctx.Value(tenantContextKey{}).(uint)
+	return id, ok
+}
+
+// WithoutTenant drops the tenant scope, for the few lookups that must see
+// every organization (e.g. finding a user by email to add as a member).
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, nil)
+}
+
+// registerTenantScope installs callbacks that scope every statement run with
+// a tenant context:
+//   - models with an OrganizationID field are filtered by it, and creates and
+//     updates always write the current tenant into it;
+//   - users are filtered to members of the organization on reads, updates
+//     and deletes. Changes to one's own account use WithoutTenant, so people
+//     without a membership can still manage themselves.
+func registerTenantScope(db *gorm.DB) {
+	cb := db.Callback()
+	must := func(err error) {
+		if err != nil {
+			log.Fatalf("FATAL: Failed to register tenant scope: %v", err)
+		}
+	}
+	must(cb.Query().Before("gorm:query").Register("tenant:query", tenantFilter(true, false)))
+	must(cb.Row().Before("gorm:row").Register("tenant:row", tenantFilter(true, false)))
+	must(cb.Delete().Before("gorm:delete").Register("tenant:delete", tenantFilter(true, false)))
+	must(cb.Update().Before("gorm:update").Register("tenant:update", tenantFilter(true, true)))
+	must(cb.Create().Before("gorm:create").Register("tenant:create", tenantAssign))
+}
+
+func tenantFilter(filterUsers, assign bool) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		tenantID, ok := TenantFromContext(db.Statement.Context)
+		if !ok || db.Statement.Schema == nil {
+			return
+		}
+		if _, scoped := db.Statement.Schema.FieldsByName["OrganizationID"]; scoped {
+			if assign {
+				tenantAssign(db)
+			}
+			db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+				clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "organization_id"}, Value: tenantID},
+			}})
+			return
+		}
+		if filterUsers && db.Statement.Schema.Table == "users" {
+			db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{clause.Expr{
+				SQL:  "? IN (SELECT user_id FROM memberships WHERE organization_id = ?)",
+				Vars: []interface{}{clause.Column{Table: clause.CurrentTable, Name: "id"}, tenantID},
+			}}})
+		}
+	}
+}
+
+// tenantAssign forces OrganizationID to the current tenant, so a client can
+// neither create rows in nor move rows to another organization.
+func tenantAssign(db *gorm.DB) {
+	tenantID, ok := TenantFromContext(db.Statement.Context)
+	if !ok || db.Statement.Schema == nil {
+		return
+	}
+	// Updates with an input struct of another type cannot carry OrganizationID
+	// at all, and SetColumn cannot write into it.
+	if dest := reflect.Indirect(reflect.ValueOf(db.Statement.Dest)); dest.Kind() == reflect.Struct && dest.Type() != db.Statement.Schema.ModelType {
+		return
+	}
+	if _, scoped := db.Statement.Schema.FieldsByName["OrganizationID"]; scoped {
+		// the column name, so an update map that already has organization_id is
+		// overwritten instead of getting the column twice
+		db.Statement.SetColumn("organization_id", tenantID, true)
+	}
+}
+
+// backfillDefaultOrganization runs once when organizations are introduced:
+// existing products move into a "default" organization and every existing
+// user becomes a member of it, so nothing disappears from view.
+func backfillDefaultOrganization(db *gorm.DB) {
+	org := models.Organization{Name: "Default", Slug: "default"}
+	if err := db.Where(models.Organization{Slug: org.Slug}).FirstOrCreate(&org).Error; err != nil {
+		log.Printf("ERROR: Failed to create default organization: %v", err)
+		return
+	}
+	db.Model(&models.Product{}).Where("organization_id = 0 OR organization_id IS NULL").Update("organization_id", org.ID)
+
+	var users []models.User
+	db.Find(&users)
+	for _, user := range users {
+		role := models.RoleOrgMember
+		if user.Role == models.RoleAdmin {
+			role = models.RoleOrgAdmin
+		}
+		membership := models.Membership{OrganizationID: org.ID, UserID: user.Id}
+		if err := db.Where(membership).Attrs(models.Membership{Role: role}).FirstOrCreate(&membership).Error; err != nil {
+			log.Printf("ERROR: Failed to add user %d to the default organization: %v", user.Id, err)
+		}
+	}
+}
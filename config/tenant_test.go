@@ -0,0 +1,143 @@
+package config
+
+import (
+	"API/models"
+	"context"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB returns a database that only builds SQL, with the tenant scope
+// registered, so the callbacks can be checked without Postgres.
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost", PreferSimpleProtocol: true}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	if err != nil {
+		t.Fatalf("open dry run database: %v", err)
+	}
+	registerTenantScope(db)
+	return db
+}
+
+func TestTenantScope(t *testing.T) {
+	db := dryRunDB(t)
+	tenant := WithTenant(context.Background(), 7)
+	name := "Renamed"
+	// input has no OrganizationID, like the update DTOs of the controllers
+	type input struct {
+		Name *string
+	}
+
+	tests := []struct {
+		name     string
+		run      func(tx *gorm.DB) *gorm.DB
+		wantSQL  string // part of the statement that must be there
+		wantVars []interface{}
+		notSQL   string // part that must not be there
+		notVars  []interface{}
+	}{
+		{
+			name:     "query is filtered by organization",
+			run:      func(tx *gorm.DB) *gorm.DB { return tx.WithContext(tenant).Find(&[]models.Product{}) },
+			wantSQL:  `WHERE "products"."organization_id" = $1`,
+			wantVars: []interface{}{uint(7)},
+		},
+		{
+			name:    "query without a tenant is not filtered",
+			run:     func(tx *gorm.DB) *gorm.DB { return tx.WithContext(context.Background()).Find(&[]models.Product{}) },
+			wantSQL: `SELECT * FROM "products"`,
+			notSQL:  "organization_id",
+		},
+		{
+			name:    "WithoutTenant drops the filter",
+			run:     func(tx *gorm.DB) *gorm.DB { return tx.WithContext(WithoutTenant(tenant)).Find(&[]models.Product{}) },
+			wantSQL: `SELECT * FROM "products"`,
+			notSQL:  "organization_id",
+		},
+		{
+			name:     "users are limited to members",
+			run:      func(tx *gorm.DB) *gorm.DB { return tx.WithContext(tenant).Find(&[]models.User{}) },
+			wantSQL:  `"users"."id" IN (SELECT user_id FROM memberships WHERE organization_id = $1)`,
+			wantVars: []interface{}{uint(7)},
+		},
+		{
+			name: "count is filtered",
+			run: func(tx *gorm.DB) *gorm.DB {
+				var n int64
+				return tx.WithContext(tenant).Model(&models.Product{}).Count(&n)
+			},
+			wantSQL:  `WHERE "products"."organization_id" = $1`,
+			wantVars: []interface{}{uint(7)},
+		},
+		{
+			name: "create assigns the tenant",
+			run: func(tx *gorm.DB) *gorm.DB {
+				return tx.WithContext(tenant).Create(&models.Product{Name: "Pen", OrganizationID: 99})
+			},
+			wantSQL:  `INSERT INTO "products"`,
+			wantVars: []interface{}{uint(7)},
+			notVars:  []interface{}{uint(99)},
+		},
+		{
+			name: "update cannot move a row to another organization",
+			run: func(tx *gorm.DB) *gorm.DB {
+				return tx.WithContext(tenant).Model(&models.Product{Id: 3}).Updates(map[string]interface{}{"name": name, "organization_id": 99})
+			},
+			wantSQL:  `SET "name"=$1,"organization_id"=$2,"updated_at"=$3 WHERE "products"."organization_id" = $4 AND "id" = $5`,
+			wantVars: []interface{}{uint(7), uint(3)},
+			notVars:  []interface{}{99},
+		},
+		{
+			name: "update with an input struct is filtered",
+			run: func(tx *gorm.DB) *gorm.DB {
+				return tx.WithContext(tenant).Model(&models.Product{Id: 3}).Updates(input{Name: &name})
+			},
+			wantSQL:  `UPDATE "products" SET "name"=$1 WHERE "products"."organization_id" = $2 AND "id" = $3`,
+			wantVars: []interface{}{&name, uint(7), uint(3)},
+		},
+		{
+			name:     "delete is filtered",
+			run:      func(tx *gorm.DB) *gorm.DB { return tx.WithContext(tenant).Delete(&models.Product{}, 3) },
+			wantSQL:  `DELETE FROM "products" WHERE "products"."id" = $1 AND "products"."organization_id" = $2`,
+			wantVars: []interface{}{3, uint(7)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt := tt.run(db.Session(&gorm.Session{NewDB: true})).Statement
+			sql := stmt.SQL.String()
+			if !strings.Contains(sql, tt.wantSQL) {
+				t.Errorf("SQL %q does not contain %q", sql, tt.wantSQL)
+			}
+			if tt.notSQL != "" && strings.Contains(sql, tt.notSQL) {
+				t.Errorf("SQL %q contains %q", sql, tt.notSQL)
+			}
+			for _, want := range tt.wantVars {
+				if !containsVar(stmt.Vars, want) {
+					t.Errorf("vars %v do not contain %v", stmt.Vars, want)
+				}
+			}
+			for _, unwanted := range tt.notVars {
+				if containsVar(stmt.Vars, unwanted) {
+					t.Errorf("vars %v contain %v", stmt.Vars, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func containsVar(vars []interface{}, want interface{}) bool {
+	for _, v := range vars {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
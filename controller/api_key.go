@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyInput struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 means the key never expires
+}
+
+func apiKeyResponse(key models.APIKey) gin.H {
+	return gin.H{
+		"id":           key.ID,
+		"user_id":      key.UserID,
+		"name":         key.Name,
+		"prefix":       key.Prefix,
+		"scopes":       key.ScopeList(),
+		"expires_at":   key.ExpiresAt,
+		"last_used_at": key.LastUsedAt,
+		"revoked_at":   key.RevokedAt,
+		"created_at":   key.CreatedAt,
+	}
+}
+
+// rejectAPIKeyAuth stops API keys from managing accounts, e.g. a leaked key
+// minting new keys. Most such routes use middleware.RejectAPIKey instead.
+func rejectAPIKeyAuth(c *gin.Context) bool {
+	if _, ok := c.Get("api_key"); ok {
+		utils.AbortWithProblem(c, http.StatusForbidden, "This endpoint cannot be used with an API key.", gin.H{"reason": "api_key_not_allowed"})
+		return true
+	}
+	return false
+}
+
+// CreateAPIKey creates a key for the current user.
+func CreateAPIKey(c *gin.Context) {
+	if rejectAPIKeyAuth(c) {
+		return
+	}
+	createAPIKeyFor(c, c.MustGet("user").(models.User))
+}
+
+// AdminCreateAPIKey creates a key for any user.
+func AdminCreateAPIKey(c *gin.Context) {
+	if rejectAPIKeyAuth(c) {
+		return
+	}
+	var owner models.User
+	if err := config.DB.WithContext(c.Request.Context()).First(&owner, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !checkCanManageUser(c, owner) {
+		return
+	}
+	createAPIKeyFor(c, owner)
+}
+
+// createAPIKeyFor stores a new key. Scopes must be permissions that both the
+// owner's role and the caller hold, so nobody can mint a key stronger than
+// their own access. The plain key is returned only in this response.
+func createAPIKeyFor(c *gin.Context, owner models.User) {
+	ctx := c.Request.Context()
+	var input APIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.Scopes) == 0 || input.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scopes must not be empty and expires_in_days must not be negative"})
+		return
+	}
+
+	_, missing := findPermissions(c, input.Scopes)
+	if len(missing) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Unknown scopes", "scopes": missing})
+		return
+	}
+	granted, err := utils.RolePermissions(ctx, owner.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load permissions"})
+		return
+	}
+	caller := c.MustGet("user").(models.User)
+	var notGranted, notHeld []string
+	for _, scope := range input.Scopes {
+		if !utils.HasPermission(granted, scope) {
+			notGranted = append(notGranted, scope)
+		} else if !callerHasPermission(c, caller, scope) {
+			notHeld = append(notHeld, scope)
+		}
+	}
+	if len(notGranted) > 0 {
+		utils.AbortWithProblem(c, http.StatusForbidden, "The owner's role does not grant these scopes.", gin.H{"scopes": notGranted})
+		return
+	}
+	if len(notHeld) > 0 {
+		utils.AbortWithProblem(c, http.StatusForbidden, "You cannot grant scopes you do not have.", gin.H{"scopes": notHeld})
+		return
+	}
+
+	raw, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate API key"})
+		return
+	}
+	key := models.APIKey{
+		UserID:  owner.Id,
+		Name:    input.Name,
+		Prefix:  prefix,
+		KeyHash: hash,
+		Scopes:  strings.Join(input.Scopes, " "),
+	}
+	if input.ExpiresInDays > 0 {
+		expires := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		key.ExpiresAt = &expires
+	}
+	if err := config.DB.WithContext(ctx).Create(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create API key"})
+		return
+	}
+
+	response := apiKeyResponse(key)
+	response["key"] = raw // shown once, never stored
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetAPIKeys lists the current user's keys.
+func GetAPIKeys(c *gin.Context) {
+	listAPIKeys(c, c.MustGet("user").(models.User).Id)
+}
+
+// AdminGetAPIKeys lists the keys of any user.
+func AdminGetAPIKeys(c *gin.Context) {
+	var owner models.User
+	if err := config.DB.WithContext(c.Request.Context()).First(&owner, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	listAPIKeys(c, owner.Id)
+}
+
+func listAPIKeys(c *gin.Context, userID uint) {
+	var keys []models.APIKey
+	if err := config.DB.WithContext(c.Request.Context()).Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch API keys"})
+		return
+	}
+	data := make([]gin.H, 0, len(keys))
+	for _, key := range keys {
+		data = append(data, apiKeyResponse(key))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// RevokeAPIKey revokes one of the current user's keys.
+func RevokeAPIKey(c *gin.Context) {
+	if rejectAPIKeyAuth(c) {
+		return
+	}
+	revokeAPIKey(c, c.MustGet("user").(models.User).Id, c.Param("keyId"))
+}
+
+// AdminRevokeAPIKey revokes a key of any user.
+func AdminRevokeAPIKey(c *gin.Context) {
+	if rejectAPIKeyAuth(c) {
+		return
+	}
+	var owner models.User
+	if err := config.DB.WithContext(c.Request.Context()).First(&owner, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !checkCanManageUser(c, owner) {
+		return
+	}
+	revokeAPIKey(c, owner.Id, c.Param("keyId"))
+}
+
+func revokeAPIKey(c *gin.Context, userID uint, keyID string) {
+	result := config.DB.WithContext(c.Request.Context()).Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke API key"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found or already revoked"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,249 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DataExportTTL is how long a finished export can be downloaded.
+const DataExportTTL = 7 * 24 * time.Hour
+
+// dataExportTimeout is how long an export may stay pending or running. Older
+// ones were lost, e.g. to a restart, and are marked failed so the user can
+// request a new one.
+const dataExportTimeout = 30 * time.Minute
+
+// dataExportDir is where archives are written, set with DATA_EXPORT_DIR.
+func dataExportDir() string {
+	if dir := os.Getenv("DATA_EXPORT_DIR"); dir != "" {
+		return dir
+	}
+	return "exports"
+}
+
+// RequestDataExport starts a job that collects everything stored about the
+// current user into a ZIP of JSON files. Poll GET /me/exports for its status.
+func RequestDataExport(c *gin.Context) {
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(models.User)
+
+	failStaleDataExports(ctx, user.Id)
+	var inProgress int64
+	config.DB.WithContext(ctx).Model(&models.DataExport{}).
+		Where("user_id = ? AND status IN ?", user.Id, []string{models.DataExportPending, models.DataExportRunning}).
+		Count(&inProgress)
+	if inProgress > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "An export is already in progress"})
+		return
+	}
+
+	export := models.DataExport{UserID: user.Id, Status: models.DataExportPending}
+	if err := config.DB.WithContext(ctx).Create(&export).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start export"})
+		return
+	}
+	go runDataExport(export.ID)
+	c.JSON(http.StatusAccepted, export)
+}
+
+// GetDataExports lists the current user's exports, newest first.
+func GetDataExports(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	failStaleDataExports(c.Request.Context(), user.Id)
+	exports := []models.DataExport{}
+	if err := config.DB.WithContext(c.Request.Context()).
+		Where("user_id = ?", user.Id).Order("created_at DESC").Find(&exports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch exports"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": exports})
+}
+
+// DownloadDataExport sends a finished export archive.
+func DownloadDataExport(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	var export models.DataExport
+	if err := config.DB.WithContext(c.Request.Context()).
+		Where("id = ? AND user_id = ?", c.Param("exportId"), user.Id).First(&export).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+	if export.Status != models.DataExportCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is not ready", "status": export.Status})
+		return
+	}
+	if export.ExpiresAt != nil && time.Now().After(*export.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "Export has expired, request a new one"})
+		return
+	}
+	c.FileAttachment(export.FilePath, fmt.Sprintf("data-export-%d.zip", export.ID))
+}
+
+// runDataExport builds the archive in the background and records the outcome.
+func runDataExport(exportID uint) {
+	ctx := context.Background()
+	db := config.DB.WithContext(ctx)
+	var export models.DataExport
+	if err := db.First(&export, exportID).Error; err != nil {
+		log.Printf("ERROR: Data export %d not found: %v", exportID, err)
+		return
+	}
+	// ทุกการอัปเดตต้องเช็กสถานะเดิม เพราะ job ที่ช้าเกินไปอาจถูก failStaleDataExports ปิดไปแล้ว
+	if result := db.Model(&export).Where("status = ?", models.DataExportPending).
+		Update("status", models.DataExportRunning); result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	path, err := writeDataExport(ctx, export)
+	if err != nil {
+		log.Printf("ERROR: Data export %d for user %d failed: %v", export.ID, export.UserID, err)
+		db.Model(&export).Where("status = ?", models.DataExportRunning).Updates(map[string]interface{}{
+			"status": models.DataExportFailed,
+			"error":  "Could not assemble the export",
+		})
+		return
+	}
+
+	now := time.Now()
+	result := db.Model(&export).Where("status = ?", models.DataExportRunning).Updates(map[string]interface{}{
+		"status":       models.DataExportCompleted,
+		"file_path":    path,
+		"completed_at": now,
+		"expires_at":   now.Add(DataExportTTL),
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		log.Printf("ERROR: Data export %d finished after it timed out, discarding it", export.ID)
+		os.Remove(path)
+	}
+}
+
+// failStaleDataExports marks exports that have been pending or running for
+// longer than dataExportTimeout as failed. userID 0 covers every user.
+func failStaleDataExports(ctx context.Context, userID uint) {
+	db := config.DB.WithContext(ctx).Model(&models.DataExport{}).
+		Where("status IN ? AND created_at < ?", []string{models.DataExportPending, models.DataExportRunning}, time.Now().Add(-dataExportTimeout))
+	if userID != 0 {
+		db = db.Where("user_id = ?", userID)
+	}
+	if err := db.Updates(map[string]interface{}{
+		"status": models.DataExportFailed,
+		"error":  "The export did not finish in time, request a new one",
+	}).Error; err != nil {
+		log.Printf("ERROR: Failed to time out stale data exports: %v", err)
+	}
+}
+
+// writeDataExport writes one JSON file per kind of record into a ZIP archive.
+func writeDataExport(ctx context.Context, export models.DataExport) (string, error) {
+	files, err := collectUserData(ctx, export.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	dir := dataExportDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	suffix, err := utils.RandomToken(8)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("export-%d-%s.zip", export.ID, suffix))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zw := zip.NewWriter(f)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err == nil {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(files[name])
+		}
+		if err != nil {
+			zw.Close()
+			f.Close()
+			os.Remove(path)
+			return "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// collectUserData gathers everything stored about a user, keyed by the file
+// name used in the archive. Secrets (password, token and key hashes) are left
+// out by the models' JSON tags.
+func collectUserData(ctx context.Context, userID uint) (map[string]interface{}, error) {
+	db := config.DB.WithContext(ctx)
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	perUser := map[string]interface{}{
+		"sessions.json":            &[]models.Session{},
+		"refresh_tokens.json":      &[]models.RefreshToken{},
+		"recovery_codes.json":      &[]models.RecoveryCode{},
+		"external_identities.json": &[]models.ExternalIdentity{},
+		"security_events.json":     &[]models.SecurityEvent{},
+		"data_exports.json":        &[]models.DataExport{},
+		"memberships.json":         &[]models.Membership{},
+	}
+	for _, dest := range perUser {
+		if err := db.Where("user_id = ?", userID).Find(dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var keys []models.APIKey
+	if err := db.Where("user_id = ?", userID).Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	apiKeys := make([]gin.H, 0, len(keys))
+	for _, key := range keys {
+		apiKeys = append(apiKeys, apiKeyResponse(key))
+	}
+
+	var auditLogs []models.AuditLog
+	if err := db.Where("user_id = ? OR actor_id = ?", userID, userID).Order("created_at").Find(&auditLogs).Error; err != nil {
+		return nil, err
+	}
+	var invitations []models.Invitation
+	if err := db.Where("invited_by = ? OR accepted_by = ?", userID, userID).Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+
+	files := perUser
+	files["export.json"] = gin.H{"user_id": user.Id, "generated_at": time.Now()}
+	files["profile.json"] = gin.H{"user": user, "created_at": user.CreatedAt, "updated_at": user.UpdatedAt}
+	files["api_keys.json"] = apiKeys
+	files["audit_log.json"] = auditLogs
+	files["invitations.json"] = invitations
+	return files, nil
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// erasureGracePeriod is how long a user can cancel an erasure request, set
+// in days with ERASURE_GRACE_DAYS (default 14).
+func erasureGracePeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ERASURE_GRACE_DAYS"))
+	if err != nil || days < 0 {
+		days = 14
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// RequestErasure schedules the current user's account for erasure after the
+// grace period. The password must be confirmed.
+func RequestErasure(c *gin.Context) {
+	ctx := ownAccountContext(c)
+	user := c.MustGet("user").(models.User)
+	var input struct {
+		Password string `json:"password"`
+	}
+	_ = c.ShouldBindJSON(&input)
+	if !confirmPassword(c, user, input.Password) {
+		return
+	}
+	if user.ErasureScheduledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Erasure has already been requested", "erasure_scheduled_at": user.ErasureScheduledAt})
+		return
+	}
+
+	erasureAt := time.Now().Add(erasureGracePeriod())
+	if err := config.DB.WithContext(ctx).Model(&user).Update("erasure_scheduled_at", erasureAt).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not schedule erasure"})
+		return
+	}
+	utils.RecordSecurityEvent(c, user.Id, models.SecurityEventErasureRequested, "erasure scheduled for "+erasureAt.Format(time.RFC3339))
+	if err := utils.SendErasureScheduledEmail(user.Email, erasureAt); err != nil {
+		log.Printf("CRITICAL: Failed to send erasure email to %s: %v", user.Email, err)
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":              "Your account and its data will be erased unless you cancel before the date below.",
+		"erasure_scheduled_at": erasureAt,
+	})
+}
+
+// CancelErasure withdraws a pending erasure request.
+func CancelErasure(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	result := config.DB.WithContext(ownAccountContext(c)).Model(&models.User{}).
+		Where("id = ? AND erasure_scheduled_at IS NOT NULL", user.Id).
+		Update("erasure_scheduled_at", nil)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not cancel erasure"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No erasure has been requested"})
+		return
+	}
+	utils.RecordSecurityEvent(c, user.Id, models.SecurityEventErasureCancelled, "erasure cancelled")
+	c.JSON(http.StatusOK, gin.H{"message": "Erasure request cancelled."})
+}
+
+// StartErasureWorker erases accounts whose grace period has passed, removes
+// expired export archives and times out lost exports, once at start and then
+// every interval.
+// It never returns, so run it in its own goroutine.
+func StartErasureWorker(interval time.Duration) {
+	for {
+		ctx := context.Background()
+		var due []uint
+		// Unscoped: บัญชีที่ลบ (soft delete) ไปแล้วก็ยังต้องถูกลบข้อมูลจริง
+		if err := config.DB.WithContext(ctx).Unscoped().Model(&models.User{}).
+			Where("erasure_scheduled_at IS NOT NULL AND erasure_scheduled_at <= ?", time.Now()).
+			Pluck("id", &due).Error; err != nil {
+			log.Printf("ERROR: Failed to look up accounts due for erasure: %v", err)
+		}
+		for _, id := range due {
+			if err := eraseUser(ctx, id); err != nil {
+				log.Printf("ERROR: Failed to erase user %d: %v", id, err)
+			} else {
+				log.Printf("SECURITY: erased user=%d", id)
+			}
+		}
+		purgeExpiredDataExports(ctx)
+		failStaleDataExports(ctx, 0)
+		if err := utils.PurgeOldQuotaUsage(ctx, time.Now()); err != nil {
+			log.Printf("ERROR: Failed to purge old quota usage: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// eraseUser hard-deletes the user and every record tied to them. Audit log
+// entries are kept for accountability, but their IP and user agent are
+// cleared.
+func eraseUser(ctx context.Context, userID uint) error {
+	var user models.User
+	if err := config.DB.WithContext(ctx).Unscoped().First(&user, userID).Error; err != nil {
+		return err
+	}
+	revokeOtherSessions(ctx, userID, "")
+	invalidateUserCache(ctx, userID)
+
+	var exportFiles []string
+	config.DB.WithContext(ctx).Model(&models.DataExport{}).
+		Where("user_id = ? AND file_path <> ''", userID).Pluck("file_path", &exportFiles)
+
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&models.Session{},
+			&models.RefreshToken{},
+			&models.RevokedToken{},
+			&models.RecoveryCode{},
+			&models.ExternalIdentity{},
+			&models.APIKey{},
+			&models.MagicLinkToken{},
+			&models.SecurityEvent{},
+			&models.DataExport{},
+			&models.Membership{},
+			&models.APIUsage{},
+		} {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.AuditLog{}).
+			Where("user_id = ? OR actor_id = ?", userID, userID).
+			Updates(map[string]interface{}{"ip": "", "user_agent": ""}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("LOWER(email) = LOWER(?)", user.Email).Delete(&models.Invitation{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.User{}, userID).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range exportFiles {
+		os.Remove(path)
+	}
+	if config.RedisClient != nil {
+		config.RedisClient.Del(ctx, UserCacheKey, loginFailAccountPrefix+normalizeLoginEmail(user.Email))
+	}
+	return nil
+}
+
+// purgeExpiredDataExports deletes archives that can no longer be downloaded.
+func purgeExpiredDataExports(ctx context.Context) {
+	var expired []models.DataExport
+	config.DB.WithContext(ctx).Where("expires_at < ? AND file_path <> ''", time.Now()).Find(&expired)
+	for _, export := range expired {
+		if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("ERROR: Failed to remove data export %s: %v", export.FilePath, err)
+			continue
+		}
+		config.DB.WithContext(ctx).Model(&export).Update("file_path", "")
+	}
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultInvitationTTL applies when an invitation does not set expires_in_days.
+const DefaultInvitationTTL = 7 * 24 * time.Hour
+
+var errInvitationUsed = errors.New("invitation has already been used")
+
+// CreateInvitation emails an invitation with a pre-assigned role. Inside an
+// organization the role is the membership role the new user will get.
+func CreateInvitation(c *gin.Context) {
+	ctx := c.Request.Context()
+	var input struct {
+		Email         string `json:"email" binding:"required,email"`
+		Role          string `json:"role"`
+		ExpiresInDays int    `json:"expires_in_days"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Role == "" {
+		input.Role = models.RoleUser
+		if tenantID, ok := config.TenantFromContext(ctx); ok && tenantID != 0 {
+			input.Role = models.RoleOrgMember
+		}
+	}
+	if !checkAssignableRole(c, input.Role) {
+		return
+	}
+	if input.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days must not be negative"})
+		return
+	}
+	ttl := DefaultInvitationTTL
+	if input.ExpiresInDays > 0 {
+		ttl = time.Duration(input.ExpiresInDays) * 24 * time.Hour
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	admin := c.MustGet("user").(models.User)
+	invitation := models.Invitation{
+		Email:     input.Email,
+		Role:      input.Role,
+		TokenHash: utils.HashToken(token),
+		InvitedBy: admin.Id,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := config.DB.WithContext(ctx).Create(&invitation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create invitation"})
+		return
+	}
+
+	if err := utils.SendInvitationEmail(invitation.Email, token, invitation.ExpiresAt); err != nil {
+		log.Printf("CRITICAL: Failed to send invitation email to %s: %v", invitation.Email, err)
+	}
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// GetInvitations lists invitations, newest first. ?status=pending hides
+// accepted, revoked and expired ones.
+func GetInvitations(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	db := config.DB.WithContext(c.Request.Context()).Model(&models.Invitation{})
+	if c.Query("status") == "pending" {
+		db = db.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", time.Now())
+	}
+
+	invitations := []models.Invitation{}
+	if err := db.Order("created_at DESC").Scopes(Paging(page, limit)).Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch invitations"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": invitations})
+}
+
+// RevokeInvitation withdraws an invitation that has not been accepted yet.
+func RevokeInvitation(c *gin.Context) {
+	result := config.DB.WithContext(c.Request.Context()).Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", c.Param("inviteId")).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke invitation"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found, already accepted or revoked"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// findInvitation returns the usable invitation for the token. It must have
+// been sent to email, because accepting it also verifies that address.
+func findInvitation(ctx context.Context, token, email string) (models.Invitation, bool) {
+	var invitation models.Invitation
+	err := config.DB.WithContext(ctx).
+		Where("token_hash = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", utils.HashToken(token), time.Now()).
+		First(&invitation).Error
+	return invitation, err == nil && strings.EqualFold(invitation.Email, strings.TrimSpace(email))
+}
+
+func roleExists(ctx context.Context, name string) bool {
+	var count int64
+	config.DB.WithContext(ctx).Model(&models.Role{}).Where("name = ?", name).Count(&count)
+	return count > 0
+}
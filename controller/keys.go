@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"API/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS publishes the public keys that verify our access tokens.
+func JWKS(c *gin.Context) {
+	km, err := utils.Keys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "JWT is not configured on the server."})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, km.JWKS())
+}
+
+// RotateSigningKey makes a freshly generated key the active signing key.
+func RotateSigningKey(c *gin.Context) {
+	km, err := utils.Keys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "JWT is not configured on the server."})
+		return
+	}
+	kid, err := km.Rotate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"kid": kid})
+}
@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Brute-force protection for /login. Failures are counted per account (to
+// stop distributed guessing against one email) and per IP+account (to slow
+// down a single client with progressively longer delays).
+const (
+	loginFailureWindow   = 15 * time.Minute
+	loginDelayThreshold  = 3 // failures before delays start
+	loginMaxDelay        = 60 * time.Second
+	loginLockoutFailures = 10 // account failures that lock the account
+	loginLockoutDuration = 15 * time.Minute
+
+	loginFailAccountPrefix = "login_fail:acct:"
+	loginFailIPPrefix      = "login_fail:ipacct:"
+	loginDelayPrefix       = "login_delay:"
+)
+
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginDelay returns how long a client must wait after its n-th failure.
+func loginDelay(failures int64) time.Duration {
+	if failures < loginDelayThreshold {
+		return 0
+	}
+	delay := time.Duration(math.Pow(2, float64(failures-loginDelayThreshold))) * time.Second
+	if delay > loginMaxDelay {
+		return loginMaxDelay
+	}
+	return delay
+}
+
+// checkLoginAllowed aborts the request when the account is locked or the
+// client is still inside its delay. user is nil for unknown emails, which
+// are throttled the same way so responses do not reveal whether they exist.
+func checkLoginAllowed(c *gin.Context, email string, user *models.User) bool {
+	ctx := c.Request.Context()
+	if user != nil && user.LockedUntil != nil && !time.Now().Before(*user.LockedUntil) {
+		// the lock has run out: forget it together with its unlock link and counters
+		if err := unlockAccount(ctx, user); err != nil {
+			log.Printf("ERROR: Failed to clear expired lock of user %d: %v", user.Id, err)
+		}
+		user.LockedUntil, user.UnlockToken, user.UnlockTokenExpires = nil, "", nil
+		user.FailedLoginCount, user.LastFailedLoginAt = 0, nil
+	}
+	if user != nil && user.LockedUntil != nil {
+		retry := time.Until(*user.LockedUntil)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		utils.AbortWithProblem(c, http.StatusLocked, "Account is temporarily locked because of too many failed login attempts.", gin.H{"retry_after": int(math.Ceil(retry.Seconds()))})
+		return false
+	}
+
+	var wait time.Duration
+	if config.RedisClient != nil {
+		ttl, err := config.RedisClient.PTTL(ctx, loginDelayPrefix+c.ClientIP()+":"+email).Result()
+		if err == nil && ttl > 0 {
+			wait = ttl
+		}
+	} else if user != nil && user.LastFailedLoginAt != nil {
+		wait = loginDelay(int64(user.FailedLoginCount)) - time.Since(*user.LastFailedLoginAt)
+	}
+
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later", "retry_after": seconds})
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure updates the counters after a wrong password and locks
+// the account once it reaches loginLockoutFailures.
+func recordLoginFailure(c *gin.Context, email string, user *models.User) {
+	ctx := c.Request.Context()
+	var accountFailures, clientFailures int64
+
+	if config.RedisClient != nil {
+		acctKey := loginFailAccountPrefix + email
+		ipKey := loginFailIPPrefix + c.ClientIP() + ":" + email
+		pipe := config.RedisClient.Pipeline()
+		acctIncr := pipe.Incr(ctx, acctKey)
+		pipe.Expire(ctx, acctKey, loginFailureWindow)
+		ipIncr := pipe.Incr(ctx, ipKey)
+		pipe.Expire(ctx, ipKey, loginFailureWindow)
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("WARNING: Failed to record login failure in Redis: %v", err)
+		}
+		accountFailures, clientFailures = acctIncr.Val(), ipIncr.Val()
+
+		if delay := loginDelay(clientFailures); delay > 0 {
+			config.RedisClient.Set(ctx, loginDelayPrefix+c.ClientIP()+":"+email, "1", delay)
+		}
+	}
+
+	if user == nil {
+		return
+	}
+
+	// The database counter is the fallback when Redis is not available.
+	count := user.FailedLoginCount + 1
+	if user.LastFailedLoginAt == nil || time.Since(*user.LastFailedLoginAt) > loginFailureWindow {
+		count = 1
+	}
+	now := time.Now()
+	config.DB.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"failed_login_count":   count,
+		"last_failed_login_at": now,
+	})
+	if config.RedisClient == nil {
+		accountFailures = int64(count)
+	}
+
+	if accountFailures >= loginLockoutFailures {
+		lockAccount(c, user)
+	}
+}
+
+// recordLoginSuccess clears the counters of the account and client, and an
+// unlock link that is no longer needed.
+func recordLoginSuccess(c *gin.Context, email string, user *models.User) {
+	ctx := c.Request.Context()
+	if config.RedisClient != nil {
+		config.RedisClient.Del(ctx,
+			loginFailAccountPrefix+email,
+			loginFailIPPrefix+c.ClientIP()+":"+email,
+			loginDelayPrefix+c.ClientIP()+":"+email)
+	}
+	if user.FailedLoginCount > 0 || user.LastFailedLoginAt != nil || user.UnlockToken != "" {
+		config.DB.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+			"failed_login_count":   0,
+			"last_failed_login_at": nil,
+			"unlock_token":         "",
+			"unlock_token_expires": nil,
+		})
+	}
+}
+
+func lockAccount(c *gin.Context, user *models.User) {
+	ctx := c.Request.Context()
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate unlock token for user %d: %v", user.Id, err)
+		return
+	}
+
+	lockedUntil := time.Now().Add(loginLockoutDuration)
+	if err := config.DB.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"locked_until":         lockedUntil,
+		"unlock_token":         utils.HashToken(token),
+		"unlock_token_expires": lockedUntil,
+	}).Error; err != nil {
+		log.Printf("ERROR: Failed to lock user %d: %v", user.Id, err)
+		return
+	}
+
+	utils.RecordSecurityEvent(c, user.Id, models.SecurityEventAccountLocked,
+		fmt.Sprintf("locked until %s after %d failed login attempts", lockedUntil.Format(time.RFC3339), loginLockoutFailures))
+	if err := utils.SendUnlockEmail(user.Email, token, loginLockoutDuration.String()); err != nil {
+		log.Printf("CRITICAL: Failed to send unlock email to %s: %v", user.Email, err)
+	}
+}
+
+func unlockAccount(ctx context.Context, user *models.User) error {
+	if config.RedisClient != nil {
+		config.RedisClient.Del(ctx, loginFailAccountPrefix+normalizeLoginEmail(user.Email))
+	}
+	return config.DB.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"locked_until":         nil,
+		"unlock_token":         "",
+		"unlock_token_expires": nil,
+		"failed_login_count":   0,
+		"last_failed_login_at": nil,
+	}).Error
+}
+
+// UnlockAccount handles the link sent in the lockout email. The link only
+// works while the lock it was sent for lasts.
+func UnlockAccount(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var user models.User
+	if err := config.DB.WithContext(ctx).Where("unlock_token = ? AND unlock_token_expires > ?", utils.HashToken(token), time.Now()).First(&user).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err := unlockAccount(ctx, &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not unlock account"})
+		return
+	}
+	utils.RecordSecurityEvent(c, user.Id, models.SecurityEventAccountUnlocked, "unlocked from email link")
+	c.JSON(http.StatusOK, gin.H{"message": "Your account has been unlocked."})
+}
+
+// AdminUnlockUser lets an administrator unlock an account.
+func AdminUnlockUser(c *gin.Context) {
+	ctx := c.Request.Context()
+	var user models.User
+	if err := config.DB.WithContext(ctx).First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !checkCanManageUser(c, user) {
+		return
+	}
+	if err := unlockAccount(ctx, &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not unlock account"})
+		return
+	}
+	admin := c.MustGet("user").(models.User)
+	utils.RecordSecurityEvent(c, user.Id, models.SecurityEventAccountUnlocked, fmt.Sprintf("unlocked by admin %d", admin.Id))
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked."})
+}
+
+// GetUserSecurityEvents lists the security events of a user, newest first.
+func GetUserSecurityEvents(c *gin.Context) {
+	var user models.User
+	if err := config.DB.WithContext(c.Request.Context()).First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	events := []models.SecurityEvent{}
+	if err := config.DB.WithContext(c.Request.Context()).
+		Where("user_id = ?", user.Id).Order("created_at DESC").
+		Scopes(Paging(page, limit)).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch security events"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": events})
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MagicLinkTTL is how long an emailed sign-in link stays valid.
+const MagicLinkTTL = 10 * time.Minute
+
+const magicLinkSentMessage = "If an account with that email exists, a sign-in link has been sent."
+
+// RequestMagicLink emails a single-use sign-in link. It answers the same way
+// whether or not the account exists, just like ForgotPassword.
+func RequestMagicLink(c *gin.Context) {
+	if !config.MagicLinkEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Magic link login is not enabled"})
+		return
+	}
+	var input struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := emailLinkRecipient(input.Email)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"message": magicLinkSentMessage})
+		return
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	link := models.MagicLinkToken{
+		UserID:    user.Id,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(MagicLinkTTL),
+	}
+	if err := config.DB.WithContext(c.Request.Context()).Create(&link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	if err := utils.SendMagicLinkEmail(user.Email, token, MagicLinkTTL.String()); err != nil {
+		log.Printf("CRITICAL: Failed to send magic link email to %s: %v", user.Email, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": magicLinkSentMessage})
+}
+
+// VerifyMagicLink exchanges a sign-in link for the same tokens /login
+// returns. Using a link also invalidates every other link of the user.
+func VerifyMagicLink(c *gin.Context) {
+	if !config.MagicLinkEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Magic link login is not enabled"})
+		return
+	}
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+	var link models.MagicLinkToken
+	if err := config.DB.WithContext(ctx).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(input.Token), now).
+		First(&link).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	// The conditional update makes sure two concurrent requests cannot both
+	// use the same link.
+	result := config.DB.WithContext(ctx).Model(&link).Where("used_at IS NULL").Update("used_at", now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	config.DB.WithContext(ctx).Model(&models.MagicLinkToken{}).
+		Where("user_id = ? AND used_at IS NULL", link.UserID).Update("used_at", now)
+
+	var user models.User
+	if err := config.DB.WithContext(ctx).First(&user, link.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if !checkLoginAllowed(c, normalizeLoginEmail(user.Email), &user) {
+		return
+	}
+
+	completeLogin(c, user)
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetMe returns the authenticated user, and the administrator acting as them
+// during impersonation.
+func GetMe(c *gin.Context) {
+	response := gin.H{"data": c.MustGet("user").(models.User)}
+	if actor, ok := c.Get("actor"); ok {
+		response["impersonated_by"] = actor.(models.User).Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateMe updates the authenticated user's own profile. Only the self
+// updatable fields are accepted, even for administrators.
+func UpdateMe(c *gin.Context) {
+	updateUser(c, c.MustGet("user").(models.User), selfUpdatableFields)
+}
+
+// ChangePassword changes the authenticated user's password after checking
+// the current one. Every other session is signed out; the session making the
+// request stays logged in.
+func ChangePassword(c *gin.Context) {
+	ctx := ownAccountContext(c)
+	user := c.MustGet("user").(models.User)
+	var input struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if ok, _ := utils.VerifyPassword(user.PasswordHash, input.CurrentPassword); !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	if !checkPasswordPolicy(c, input.NewPassword, user.Email, user.Username) {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	if err := config.DB.WithContext(ctx).Model(&user).Updates(passwordChangeUpdates(hashedPassword)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	revokeOtherSessions(ctx, user.Id, currentSessionID(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been changed. Other sessions have been signed out."})
+}
+
+// DeleteMe deletes the authenticated user's account. The current password
+// must be confirmed, unless the account has none (external logins only).
+func DeleteMe(c *gin.Context) {
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(models.User)
+	var input struct {
+		Password string `json:"password"`
+	}
+	c.ShouldBindJSON(&input)
+
+	if !confirmPassword(c, user, input.Password) {
+		return
+	}
+
+	// บัญชีของตัวเองต้องลบได้เสมอ ไม่ว่าจะอยู่ในองค์กรไหนหรือไม่มีองค์กรเลย
+	ctx = config.WithoutTenant(ctx)
+	if err := revokeUserTokens(ctx, user.Id); err != nil {
+		log.Printf("ERROR: Failed to revoke tokens of user %d: %v", user.Id, err)
+	}
+	invalidateUserCache(ctx, user.Id)
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.Id).Delete(&models.Membership{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&user)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to delete user."})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// confirmPassword answers 401 unless password is the user's password.
+// Accounts without a password (external logins only) need no confirmation.
+func confirmPassword(c *gin.Context, user models.User, password string) bool {
+	if ok, _ := utils.VerifyPassword(user.PasswordHash, password); user.PasswordHash != "" && !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return false
+	}
+	return true
+}
+
+// GetUsage reports the daily and monthly quota usage of the authenticated
+// user and of the API key the request was made with. A limit of 0 means the
+// quota is unlimited and remaining is then -1.
+func GetUsage(c *gin.Context) {
+	usage, err := utils.GetQuotaUsage(c.Request.Context(), utils.QuotaSubjectsFromContext(c), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load usage"})
+		return
+	}
+	quotas := make([]gin.H, 0, len(usage))
+	for _, period := range usage {
+		quotas = append(quotas, gin.H{
+			"subject":   period.Subject.String(),
+			"period":    period.Period,
+			"limit":     period.Limit,
+			"used":      period.Used,
+			"remaining": period.Remaining(),
+			"start":     period.Start,
+			"reset_at":  period.ResetAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"quotas": quotas})
+}
@@ -0,0 +1,348 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"context"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	MFAChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+	// mfaChallengeMaxFailures wrong codes invalidate the challenge, so the
+	// password has to be entered again.
+	mfaChallengeMaxFailures = 5
+	mfaChallengeFailPrefix  = "mfa_fail:"
+)
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Go_API"
+}
+
+// completeLogin is called once the first factor has been checked. Users with
+// TOTP enabled get an mfa_required challenge instead of tokens.
+func completeLogin(c *gin.Context, user models.User) {
+	if !user.TOTPEnabled {
+		issueTokenPair(c, user)
+		return
+	}
+
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	mfaToken, err := utils.SignToken(jwt.MapClaims{
+		"sub":  user.Id,
+		"exp":  time.Now().Add(MFAChallengeTTL).Unix(),
+		"iat":  time.Now().Unix(),
+		"jti":  jti,
+		"type": "mfa_challenge",
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+		"methods":      []string{"totp", "recovery_code"},
+		"expires_in":   int(MFAChallengeTTL.Seconds()),
+	})
+}
+
+// LoginMFA completes a login that returned mfa_required.
+func LoginMFA(c *gin.Context) {
+	var input struct {
+		MFAToken     string `json:"mfa_token" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	claims, err := utils.ParseToken(input.MFAToken)
+	if err != nil || claims["type"] != "mfa_challenge" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+	jti, _ := claims["jti"].(string)
+	if utils.IsJTIRevoked(ctx, jti) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.WithContext(ctx).First(&user, claims["sub"]).Error; err != nil || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	// รหัสผิดนับรวมกับรหัสผ่านผิด ทั้งการหน่วงเวลาและการล็อกบัญชี
+	email := normalizeLoginEmail(user.Email)
+	if !checkLoginAllowed(c, email, &user) {
+		return
+	}
+	exp, _ := claims.GetExpirationTime()
+	if !verifySecondFactor(ctx, &user, input.Code, input.RecoveryCode) {
+		recordLoginFailure(c, email, &user)
+		if recordMFAChallengeFailure(ctx, jti) >= mfaChallengeMaxFailures && exp != nil {
+			utils.RevokeJTI(ctx, jti, user.Id, exp.Time)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Too many invalid codes, log in again"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+	recordLoginSuccess(c, email, &user)
+
+	// challenge ใช้ได้ครั้งเดียว
+	if exp != nil {
+		utils.RevokeJTI(ctx, jti, user.Id, exp.Time)
+	}
+	issueTokenPair(c, user)
+}
+
+// recordMFAChallengeFailure counts a wrong code against the challenge and
+// returns the count so far. Without Redis it returns 0 and only the account
+// lockout of the login guard applies.
+func recordMFAChallengeFailure(ctx context.Context, jti string) int64 {
+	if config.RedisClient == nil {
+		return 0
+	}
+	key := mfaChallengeFailPrefix + jti
+	pipe := config.RedisClient.Pipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, MFAChallengeTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("WARNING: Failed to record MFA failure in Redis: %v", err)
+	}
+	return incr.Val()
+}
+
+// EnrollTOTP creates a new, not yet active, TOTP secret for the current user.
+func EnrollTOTP(c *gin.Context) {
+	ctx := ownAccountContext(c)
+	user := c.MustGet("user").(models.User)
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate secret"})
+		return
+	}
+	if err := config.DB.WithContext(ctx).Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save secret"})
+		return
+	}
+
+	uri := utils.TOTPProvisioningURI(totpIssuer(), user.Email, secret)
+	png, err := utils.TOTPQRCodePNG(uri)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate QR code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": uri,
+		"qr_png":      base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// TOTPQRCode returns the QR code of the pending enrolment as a PNG image.
+func TOTPQRCode(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	if user.TOTPSecret == "" || user.TOTPEnabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending two-factor enrolment"})
+		return
+	}
+	png, err := utils.TOTPQRCodePNG(utils.TOTPProvisioningURI(totpIssuer(), user.Email, user.TOTPSecret))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate QR code"})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+// ConfirmTOTP activates the pending secret once the user proves they can
+// generate codes with it, and returns a fresh set of recovery codes.
+func ConfirmTOTP(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := ownAccountContext(c)
+	user := c.MustGet("user").(models.User)
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start the enrolment first"})
+		return
+	}
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, input.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	var codes []string
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.Id)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled.",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP turns two-factor authentication off after checking a code.
+func DisableTOTP(c *gin.Context) {
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := ownAccountContext(c)
+	user := c.MustGet("user").(models.User)
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !verifySecondFactor(ctx, &user, input.Code, input.RecoveryCode) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.Id).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not disable two-factor authentication"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled."})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the current user.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := ownAccountContext(c)
+	user := c.MustGet("user").(models.User)
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !verifySecondFactor(ctx, &user, input.Code, "") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(config.DB.WithContext(ctx), user.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate recovery codes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+// Both are consumed with conditional updates so they cannot be used twice.
+func verifySecondFactor(ctx context.Context, user *models.User, code, recoveryCode string) bool {
+	if code != "" {
+		step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return false
+		}
+		result := config.DB.WithContext(ctx).Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.Id, step).
+			Update("totp_last_step", step)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	if recoveryCode != "" {
+		hash := utils.HashToken(normalizeRecoveryCode(recoveryCode))
+		result := config.DB.WithContext(ctx).Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.Id, hash).
+			Update("used_at", time.Now())
+		return result.Error == nil && result.RowsAffected == 1
+	}
+	return false
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := utils.RandomToken(8)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(raw[:5] + "-" + raw[5:10])
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(normalizeRecoveryCode(code))})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+var (
+	errOIDCEmailNotVerified   = errors.New("the identity provider did not return a verified email address")
+	errOIDCRegistrationClosed = errors.New("no account exists for this identity and registration is not open")
+)
+
+// GetOIDCProviders lists the identity providers users can sign in with.
+func GetOIDCProviders(c *gin.Context) {
+	names := []string{}
+	for name := range utils.OIDCProviders() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	c.JSON(http.StatusOK, gin.H{"data": names})
+}
+
+// OIDCLogin starts the authorization code flow. The state, nonce and PKCE
+// verifier are kept in a short-lived signed cookie, so no server side storage
+// is needed. Pass ?redirect=false to get the URL as JSON instead of a 302.
+func OIDCLogin(c *gin.Context) {
+	provider, ok := utils.OIDCProviders()[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	state, errState := utils.RandomToken(24)
+	nonce, errNonce := utils.RandomToken(24)
+	verifier, challenge, errPKCE := utils.NewPKCE()
+	if errState != nil || errNonce != nil || errPKCE != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start login"})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		log.Printf("ERROR: OIDC provider %s: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	cookie, err := utils.SignToken(jwt.MapClaims{
+		"type":     "oidc_state",
+		"provider": provider.Name,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(oidcStateTTL).Unix(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start login"})
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, cookie, int(oidcStateTTL.Seconds()), "/auth/oidc", "", c.Request.TLS != nil, true)
+
+	if c.Query("redirect") == "false" {
+		c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback finishes the flow: it checks the state, redeems the code,
+// validates the ID token and then logs the linked user in exactly like
+// Login does, including the lockout of the login guard.
+func OIDCCallback(c *gin.Context) {
+	ctx := c.Request.Context()
+	provider, ok := utils.OIDCProviders()[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+	if errParam := c.Query("error"); errParam != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider returned an error: " + errParam})
+		return
+	}
+
+	raw, err := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/auth/oidc", "", c.Request.TLS != nil, true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login session expired, please start again"})
+		return
+	}
+	stateClaims, err := utils.ParseToken(raw)
+	if err != nil || stateClaims["type"] != "oidc_state" || stateClaims["provider"] != provider.Name ||
+		c.Query("state") == "" || stateClaims["state"] != c.Query("state") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login state"})
+		return
+	}
+	nonce, _ := stateClaims["nonce"].(string)
+	verifier, _ := stateClaims["verifier"].(string)
+
+	idToken, err := provider.Exchange(ctx, c.Query("code"), verifier)
+	if err != nil {
+		log.Printf("ERROR: OIDC code exchange with %s failed: %v", provider.Name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not complete login with the identity provider"})
+		return
+	}
+	claims, err := provider.VerifyIDToken(ctx, idToken, nonce)
+	if err != nil {
+		log.Printf("ERROR: OIDC ID token from %s rejected: %v", provider.Name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid ID token"})
+		return
+	}
+
+	user, err := linkExternalIdentity(ctx, provider.Name, claims)
+	if errors.Is(err, errOIDCEmailNotVerified) || errors.Is(err, errOIDCRegistrationClosed) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to link %s identity %s: %v", provider.Name, claims.Subject, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not sign in"})
+		return
+	}
+	if !checkLoginAllowed(c, normalizeLoginEmail(user.Email), &user) {
+		return
+	}
+
+	completeLogin(c, user)
+}
+
+// linkExternalIdentity finds the user for an external identity. Unknown
+// identities are linked to the user with the same verified email, or a new
+// user is created on first login while registration is open.
+func linkExternalIdentity(ctx context.Context, provider string, claims *utils.IDTokenClaims) (models.User, error) {
+	var user models.User
+	now := time.Now()
+
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var identity models.ExternalIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+		if err == nil {
+			tx.Model(&identity).Update("last_login_at", now)
+			return tx.First(&user, identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Linking by email is only safe when the provider vouches for it.
+		if claims.Email == "" || !claims.EmailVerified {
+			return errOIDCEmailNotVerified
+		}
+
+		err = tx.Where("LOWER(email) = ?", strings.ToLower(claims.Email)).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// บัญชีใหม่จาก OIDC สร้างได้เฉพาะเมื่อเปิดให้ลงทะเบียนทั่วไป
+			if config.RegistrationMode() != config.RegistrationOpen {
+				return errOIDCRegistrationClosed
+			}
+			user = models.User{
+				Username:        claims.Email,
+				Name:            claims.Name,
+				Email:           claims.Email,
+				Role:            models.RoleUser,
+				EmailVerifiedAt: &now,
+			}
+			err = tx.Create(&user).Error
+		} else if err == nil && !user.EmailVerified() {
+			// The provider proved ownership of the address for us.
+			err = tx.Model(&user).Update("email_verified_at", now).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		identity = models.ExternalIdentity{
+			UserID:      user.Id,
+			Provider:    provider,
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+			LastLoginAt: &now,
+		}
+		return tx.Create(&identity).Error
+	})
+	return user, err
+}
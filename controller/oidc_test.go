@@ -0,0 +1,408 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	mockClientID    = "api-client"
+	mockRedirectURL = "http://api.test/auth/oidc/mock/callback"
+)
+
+// testIssuer backs the "mock" provider. OIDCProviders is read once per
+// process, so every test shares it.
+var testIssuer *mockIssuer
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	testIssuer = newMockIssuer()
+	os.Setenv("JWT_SECRET", "oidc-test-secret")
+	os.Setenv("OIDC_PROVIDERS", "mock")
+	os.Setenv("OIDC_MOCK_ISSUER", testIssuer.URL)
+	os.Setenv("OIDC_MOCK_CLIENT_ID", mockClientID)
+	os.Setenv("OIDC_MOCK_REDIRECT_URL", mockRedirectURL)
+	code := m.Run()
+	testIssuer.Close()
+	os.Exit(code)
+}
+
+// mockIssuer is a minimal OpenID provider: discovery, JWKS, an authorization
+// endpoint that approves every request and a token endpoint that checks the
+// PKCE verifier before it issues an ID token.
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockAuthRequest
+	// claims and signer change the ID tokens issued next.
+	claims func(jwt.MapClaims)
+	signer *rsa.PrivateKey
+}
+
+type mockAuthRequest struct {
+	challenge, nonce, redirectURI string
+}
+
+func newMockIssuer() *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	m := &mockIssuer{key: key, codes: map[string]mockAuthRequest{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeMockJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeMockJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock-key",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", m.authorize)
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+// issue makes the following ID tokens use claims and signer (nil keeps the
+// issuer's own key) until the test ends.
+func (m *mockIssuer) issue(t *testing.T, claims func(jwt.MapClaims), signer *rsa.PrivateKey) {
+	m.mu.Lock()
+	m.claims, m.signer = claims, signer
+	m.mu.Unlock()
+	t.Cleanup(func() {
+		m.mu.Lock()
+		m.claims, m.signer = nil, nil
+		m.mu.Unlock()
+	})
+}
+
+func (m *mockIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != mockClientID ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" ||
+		!strings.Contains(q.Get("scope"), "openid") {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	code, _ := utils.RandomToken(16)
+	m.mu.Lock()
+	m.codes[code] = mockAuthRequest{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), redirectURI: q.Get("redirect_uri")}
+	m.mu.Unlock()
+	redirect := q.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != mockClientID {
+		writeMockJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	request, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code")) // codes are single use
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || request.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != request.challenge {
+		writeMockJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            m.URL,
+		"aud":            mockClientID,
+		"sub":            "mock-subject",
+		"email":          "mock@example.com",
+		"email_verified": true,
+		"nonce":          request.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+	if m.claims != nil {
+		m.claims(claims)
+	}
+	signer := m.key
+	if m.signer != nil {
+		signer = m.signer
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "mock-key"
+	idToken, err := token.SignedString(signer)
+	if err != nil {
+		writeMockJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeMockJSON(w, http.StatusOK, map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": idToken})
+}
+
+func writeMockJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func oidcTestRouter() *gin.Engine {
+	router := gin.New()
+	router.GET("/auth/oidc/:provider/login", OIDCLogin)
+	router.GET("/auth/oidc/:provider/callback", OIDCCallback)
+	return router
+}
+
+// startOIDCLogin starts a login and lets the mock issuer approve it. It
+// returns the state cookie and the query the issuer redirected back with.
+func startOIDCLogin(t *testing.T, router *gin.Engine) ([]*http.Cookie, url.Values) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login?redirect=false", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: status %d, body %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(body.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorize: status %d, no redirect: %v", resp.StatusCode, err)
+	}
+	if !strings.HasPrefix(location.String(), mockRedirectURL+"?") {
+		t.Fatalf("authorize redirected to %s", location)
+	}
+	return rec.Result().Cookies(), location.Query()
+}
+
+func finishOIDCLogin(router *gin.Engine, cookies []*http.Cookie, query url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/callback?"+query.Encode(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func oidcLogin(t *testing.T, router *gin.Engine) *httptest.ResponseRecorder {
+	t.Helper()
+	cookies, query := startOIDCLogin(t, router)
+	return finishOIDCLogin(router, cookies, query)
+}
+
+func TestOIDCProviderCodeExchange(t *testing.T) {
+	ctx := t.Context()
+	provider := utils.OIDCProviders()["mock"]
+	verifier, challenge, err := utils.NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil || location.Query().Get("state") != "state-1" {
+		t.Fatalf("authorize: status %d, location %v", resp.StatusCode, location)
+	}
+	code := location.Query().Get("code")
+
+	idToken, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, idToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if claims.Subject != "mock-subject" || claims.Email != "mock@example.com" || !claims.EmailVerified {
+		t.Fatalf("claims %+v", claims)
+	}
+	if _, err := provider.Exchange(ctx, code, verifier); err == nil {
+		t.Fatal("a code could be redeemed twice")
+	}
+}
+
+func TestOIDCCallbackRejectsInvalidIDTokens(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name   string
+		claims func(jwt.MapClaims)
+		signer *rsa.PrivateKey
+	}{
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, nil},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }, nil},
+		{"wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "replayed" }, nil},
+		{"no nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, nil},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, nil},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, nil},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, nil},
+		{"foreign signature", nil, otherKey},
+	}
+	router := oidcTestRouter()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			testIssuer.issue(t, tc.claims, tc.signer)
+			rec := oidcLogin(t, router)
+			if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Invalid ID token") {
+				t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRequiresPKCEVerifier(t *testing.T) {
+	router := oidcTestRouter()
+	cookies, query := startOIDCLogin(t, router)
+
+	// same state and nonce, but a verifier that does not match the challenge
+	state, err := utils.ParseToken(cookies[0].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state["verifier"] = "not-the-verifier"
+	forged, err := utils.SignToken(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := finishOIDCLogin(router, []*http.Cookie{{Name: oidcStateCookie, Value: forged}}, query)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Could not complete login") {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	router := oidcTestRouter()
+	cookies, query := startOIDCLogin(t, router)
+	query.Set("state", "forged-state")
+	if rec := finishOIDCLogin(router, cookies, query); rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := finishOIDCLogin(router, nil, query); rec.Code != http.StatusBadRequest {
+		t.Fatalf("without cookie: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+// useTestDatabase points config.DB at the Postgres database in
+// TEST_DATABASE_DSN, or skips the test when there is none.
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.ExternalIdentity{}, &models.Session{},
+		&models.RefreshToken{}, &models.SecurityEvent{}, &models.Organization{}, &models.Membership{}); err != nil {
+		t.Fatal(err)
+	}
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() { config.DB = previous })
+}
+
+func TestOIDCCallbackLinksVerifiedEmail(t *testing.T) {
+	useTestDatabase(t)
+	suffix, _ := utils.RandomToken(6)
+	suffix = strings.ToLower(suffix)
+	user := models.User{Username: "oidc-" + suffix, Email: "Oidc-" + suffix + "@example.com", Role: models.RoleUser}
+	if err := config.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, model := range []interface{}{&models.ExternalIdentity{}, &models.Session{}, &models.RefreshToken{}, &models.SecurityEvent{}} {
+			config.DB.Where("user_id = ?", user.Id).Delete(model)
+		}
+		config.DB.Unscoped().Delete(&models.User{}, user.Id)
+	})
+	router := oidcTestRouter()
+
+	// an unverified email is never linked to the existing account
+	testIssuer.issue(t, func(c jwt.MapClaims) {
+		c["sub"], c["email"], c["email_verified"] = "unverified-"+suffix, user.Email, false
+	}, nil)
+	if rec := oidcLogin(t, router); rec.Code != http.StatusForbidden {
+		t.Fatalf("unverified email: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	// a verified email, in any case, is linked and logs the user in
+	subject := "verified-" + suffix
+	testIssuer.issue(t, func(c jwt.MapClaims) {
+		c["sub"], c["email"], c["email_verified"] = subject, strings.ToLower(user.Email), true
+	}, nil)
+	rec := oidcLogin(t, router)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "access_token") {
+		t.Fatalf("verified email: status %d, body %s", rec.Code, rec.Body)
+	}
+	var identity models.ExternalIdentity
+	if err := config.DB.Where("provider = ? AND subject = ?", "mock", subject).First(&identity).Error; err != nil {
+		t.Fatalf("identity not linked: %v", err)
+	}
+	if identity.UserID != user.Id {
+		t.Fatalf("identity linked to user %d, want %d", identity.UserID, user.Id)
+	}
+	var linked models.User
+	config.DB.First(&linked, user.Id)
+	if linked.EmailVerifiedAt == nil {
+		t.Fatal("email was not marked verified")
+	}
+
+	// the login guard also applies to external logins
+	lockedUntil := time.Now().Add(time.Hour)
+	config.DB.Model(&linked).Update("locked_until", lockedUntil)
+	if rec := oidcLogin(t, router); rec.Code != http.StatusLocked {
+		t.Fatalf("locked account: status %d, body %s", rec.Code, rec.Body)
+	}
+}
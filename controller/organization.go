@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// CreateOrganization adds a tenant. Members are added afterwards.
+func CreateOrganization(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" binding:"required"`
+		Slug string `json:"slug" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Slug = strings.ToLower(input.Slug)
+	if !orgSlugPattern.MatchString(input.Slug) {
+		utils.AbortWithProblem(c, http.StatusUnprocessableEntity, "slug may only contain lowercase letters, digits and single dashes.", gin.H{"fields": []string{"slug"}})
+		return
+	}
+
+	org := models.Organization{Name: input.Name, Slug: input.Slug}
+	if err := config.DB.WithContext(c.Request.Context()).Create(&org).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Could not create organization: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, org)
+}
+
+// GetOrganizations lists every organization.
+func GetOrganizations(c *gin.Context) {
+	orgs := []models.Organization{}
+	if err := config.DB.WithContext(c.Request.Context()).Order("id").Find(&orgs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch organizations"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": orgs})
+}
+
+// GetMyOrganizations lists the organizations the current user belongs to and
+// their role in each. Any of them can be selected with X-Organization-ID.
+func GetMyOrganizations(c *gin.Context) {
+	ctx := config.WithoutTenant(c.Request.Context())
+	user := c.MustGet("user").(models.User)
+
+	var memberships []models.Membership
+	if err := config.DB.WithContext(ctx).Where("user_id = ?", user.Id).Order("id").Find(&memberships).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch organizations"})
+		return
+	}
+	ids := make([]uint, 0, len(memberships))
+	for _, m := range memberships {
+		ids = append(ids, m.OrganizationID)
+	}
+	var orgs []models.Organization
+	config.DB.WithContext(ctx).Where("id IN ?", ids).Find(&orgs)
+	byID := map[uint]models.Organization{}
+	for _, org := range orgs {
+		byID[org.ID] = org
+	}
+
+	current, _ := c.Get("organization_id")
+	data := make([]gin.H, 0, len(memberships))
+	for _, m := range memberships {
+		data = append(data, gin.H{
+			"organization": byID[m.OrganizationID],
+			"role":         m.Role,
+			"current":      current == m.OrganizationID,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// GetMembers lists the members of the current organization.
+func GetMembers(c *gin.Context) {
+	if !requireTenant(c) {
+		return
+	}
+	members := []models.Membership{}
+	if err := config.DB.WithContext(c.Request.Context()).Order("id").Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch members"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": members})
+}
+
+// AddMember adds an existing user, found by email, to the current
+// organization.
+func AddMember(c *gin.Context) {
+	ctx := c.Request.Context()
+	if !requireTenant(c) {
+		return
+	}
+	var input struct {
+		Email string `json:"email" binding:"required"`
+		Role  string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Role == "" {
+		input.Role = models.RoleOrgMember
+	}
+	if !checkAssignableRole(c, input.Role) {
+		return
+	}
+
+	var user models.User
+	if err := config.DB.WithContext(config.WithoutTenant(ctx)).Where("email = ?", input.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	membership := models.Membership{UserID: user.Id, Role: input.Role}
+	if err := config.DB.WithContext(ctx).Create(&membership).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member"})
+		return
+	}
+	invalidateUserCache(ctx, user.Id)
+	c.JSON(http.StatusCreated, membership)
+}
+
+// UpdateMember changes a member's role in the current organization.
+func UpdateMember(c *gin.Context) {
+	ctx := c.Request.Context()
+	if !requireTenant(c) {
+		return
+	}
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkAssignableRole(c, input.Role) {
+		return
+	}
+
+	membership, ok := findMember(c)
+	if !ok {
+		return
+	}
+	if err := config.DB.WithContext(ctx).Model(&membership).Update("role", input.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update member"})
+		return
+	}
+	c.JSON(http.StatusOK, membership)
+}
+
+// RemoveMember removes a user from the current organization. The account
+// itself is left alone.
+func RemoveMember(c *gin.Context) {
+	ctx := c.Request.Context()
+	if !requireTenant(c) {
+		return
+	}
+	membership, ok := findMember(c)
+	if !ok {
+		return
+	}
+	invalidateUserCache(ctx, membership.UserID)
+	if err := config.DB.WithContext(ctx).Delete(&membership).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not remove member"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// findMember loads the membership of :userId in the current organization and
+// refuses members whose global account is more privileged than the caller.
+func findMember(c *gin.Context) (models.Membership, bool) {
+	ctx := c.Request.Context()
+	var membership models.Membership
+	if err := config.DB.WithContext(ctx).Where("user_id = ?", c.Param("userId")).First(&membership).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return membership, false
+	}
+	var user models.User
+	if err := config.DB.WithContext(ctx).First(&user, membership.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return membership, false
+	}
+	return membership, checkCanManageUser(c, user)
+}
+
+// requireTenant answers 400 unless the request has an organization selected.
+func requireTenant(c *gin.Context) bool {
+	if id, ok := config.TenantFromContext(c.Request.Context()); !ok || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Select an organization with the X-Organization-ID header"})
+		return false
+	}
+	return true
+}
+
+// ownAccountContext returns the request context without the tenant scope,
+// for users changing their own account. Updates of users are limited to
+// members of the current organization, which would otherwise stop people
+// without a membership from managing themselves.
+func ownAccountContext(c *gin.Context) context.Context {
+	return config.WithoutTenant(c.Request.Context())
+}
+
+// checkAssignableRole answers 422 for unknown roles and 403 when a caller
+// without roles:admin hands out a role that grants platform permissions.
+func checkAssignableRole(c *gin.Context, role string) bool {
+	ctx := c.Request.Context()
+	if !roleExists(ctx, role) {
+		utils.AbortWithProblem(c, http.StatusUnprocessableEntity, "Role does not exist.", gin.H{"fields": []string{"role"}})
+		return false
+	}
+	if callerHasPermission(c, c.MustGet("user").(models.User), models.PermRolesAdmin) {
+		return true
+	}
+	perms, err := utils.RolePermissions(ctx, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load permissions"})
+		return false
+	}
+	for _, p := range perms {
+		for _, platform := range models.PlatformPermissions {
+			if utils.HasPermission([]string{p}, platform) {
+				utils.AbortWithProblem(c, http.StatusForbidden, fmt.Sprintf("Only role administrators can assign roles granting '%s'.", p), gin.H{"missing_permission": models.PermRolesAdmin})
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// tenantCacheKey prefixes a cache key with the current organization, so rows
+// cached for one tenant are never served to another.
+func tenantCacheKey(ctx context.Context, key string) string {
+	if tenantID, ok := config.TenantFromContext(ctx); ok {
+		return fmt.Sprintf("org:%d:%s", tenantID, key)
+	}
+	return key
+}
+
+// invalidateUserCache drops the cached user under every tenant it may have
+// been cached for.
+func invalidateUserCache(ctx context.Context, userID uint) {
+	if config.RedisClient == nil {
+		return
+	}
+	var orgIDs []uint
+	config.DB.WithContext(config.WithoutTenant(ctx)).Model(&models.Membership{}).
+		Where("user_id = ?", userID).Pluck("organization_id", &orgIDs)
+	keys := []string{fmt.Sprintf("user:%d", userID), fmt.Sprintf("org:0:user:%d", userID)}
+	for _, orgID := range orgIDs {
+		keys = append(keys, fmt.Sprintf("org:%d:user:%d", orgID, userID))
+	}
+	config.RedisClient.Del(ctx, keys...)
+}
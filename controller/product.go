@@ -22,7 +22,7 @@ func GetProducts(c *gin.Context) {
 
 	// 1. Try to get from cache first
 	if config.RedisClient != nil {
-		cacheData, err := config.RedisClient.Get(ctx, AllProductsCacheKey).Result()
+		cacheData, err := config.RedisClient.Get(ctx, tenantCacheKey(ctx, AllProductsCacheKey)).Result()
 		if err == nil {
 			var products []models.Product
 			if json.Unmarshal([]byte(cacheData), &products) == nil {
@@ -43,7 +43,7 @@ func GetProducts(c *gin.Context) {
 	if config.RedisClient != nil {
 		productsJSON, err := json.Marshal(products)
 		if err == nil {
-			go config.RedisClient.Set(context.Background(), AllProductsCacheKey, productsJSON, ProductCacheTTL)
+			go config.RedisClient.Set(context.Background(), tenantCacheKey(ctx, AllProductsCacheKey), productsJSON, ProductCacheTTL)
 		}
 	}
 
@@ -53,7 +53,7 @@ func GetProducts(c *gin.Context) {
 func GetProductByID(c *gin.Context) {
 	ctx := c.Request.Context()
 	id := c.Param("id")
-	productCacheKey := "product:" + id
+	productCacheKey := tenantCacheKey(ctx, "product:"+id)
 
 	// 1. Try to get from cache
 	if config.RedisClient != nil {
@@ -86,43 +86,74 @@ func GetProductByID(c *gin.Context) {
 }
 
 func CreateProduct(c *gin.Context) {
+	ctx := c.Request.Context()
+	if !requireTenant(c) {
+		return
+	}
 	var product models.Product
 	if err := c.ShouldBindJSON(&product); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	product.Id = 0 // ids are assigned by the database, never by the client
 
-	if result := config.DB.Create(&product); result.Error != nil {
+	if result := config.DB.WithContext(ctx).Create(&product); result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create product: " + result.Error.Error()})
 		return
 	}
 	if config.RedisClient != nil {
-		go config.RedisClient.Del(context.Background(), AllProductsCacheKey)
+		go config.RedisClient.Del(context.Background(), tenantCacheKey(ctx, AllProductsCacheKey))
 	}
 
 	c.JSON(http.StatusCreated, product)
 }
 
+// ProductInput lists the product fields a client may change. The id and the
+// organization are never taken from the request body.
+type ProductInput struct {
+	SKU           *string  `json:"sku"`
+	Name          *string  `json:"name"`
+	Description   *string  `json:"description"`
+	Price         *float64 `json:"price"`
+	StockQuantity *int     `json:"stock_quantity"`
+	CategoryID    *uint    `json:"category_id"`
+	ImageURL      *string  `json:"image_url"`
+	// Updates with a struct of another type does not fill updated_at itself.
+	UpdatedAt time.Time `json:"-"`
+}
+
 func UpdateProduct(c *gin.Context) {
+	ctx := c.Request.Context()
 	id := c.Param("id")
 	var product models.Product
 
-	if result := config.DB.First(&product, id); result.Error != nil {
+	if result := config.DB.WithContext(ctx).First(&product, id); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
-	if err := c.ShouldBindJSON(&product); err != nil {
+	var input ProductInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	input.UpdatedAt = time.Now()
 
-	config.DB.Save(&product)
+	result := config.DB.WithContext(ctx).Model(&product).Updates(input)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update product: " + result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	config.DB.WithContext(ctx).First(&product, product.Id)
 
 	// Invalidate caches
 	if config.RedisClient != nil {
-		productCacheKey := "product:" + id
-		go config.RedisClient.Del(context.Background(), AllProductsCacheKey)
+		productCacheKey := tenantCacheKey(ctx, "product:"+id)
+		go config.RedisClient.Del(context.Background(), tenantCacheKey(ctx, AllProductsCacheKey))
 		go config.RedisClient.Del(context.Background(), productCacheKey)
 	}
 
@@ -130,6 +161,7 @@ func UpdateProduct(c *gin.Context) {
 }
 
 func DeleteProduct(c *gin.Context) {
+	ctx := c.Request.Context()
 	id := c.Param("id")
 
 	// Convert id to uint for GORM
@@ -139,7 +171,7 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	result := config.DB.Delete(&models.Product{}, uid)
+	result := config.DB.WithContext(ctx).Delete(&models.Product{}, uid)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
@@ -151,8 +183,8 @@ func DeleteProduct(c *gin.Context) {
 
 	// Invalidate caches
 	if config.RedisClient != nil {
-		productCacheKey := "product:" + id
-		go config.RedisClient.Del(context.Background(), AllProductsCacheKey)
+		productCacheKey := tenantCacheKey(ctx, "product:"+id)
+		go config.RedisClient.Del(context.Background(), tenantCacheKey(ctx, AllProductsCacheKey))
 		go config.RedisClient.Del(context.Background(), productCacheKey)
 	}
 
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+func GetPermissions(c *gin.Context) {
+	var permissions []models.Permission
+	if err := config.DB.WithContext(c.Request.Context()).Order("name").Find(&permissions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch permissions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": permissions})
+}
+
+func GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := config.DB.WithContext(c.Request.Context()).Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch roles"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": roles})
+}
+
+func CreateRole(c *gin.Context) {
+	var input RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	perms, missing := findPermissions(c, input.Permissions)
+	if len(missing) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Unknown permissions", "permissions": missing})
+		return
+	}
+
+	role := models.Role{Name: input.Name, Description: input.Description, Permissions: perms}
+	if err := config.DB.WithContext(c.Request.Context()).Create(&role).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Could not create role: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole replaces the description and the full permission set of a role.
+func UpdateRole(c *gin.Context) {
+	ctx := c.Request.Context()
+	var role models.Role
+	if err := config.DB.WithContext(ctx).Where("name = ?", c.Param("name")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	var input RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	perms, missing := findPermissions(c, input.Permissions)
+	if len(missing) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Unknown permissions", "permissions": missing})
+		return
+	}
+
+	role.Description = input.Description
+	if err := config.DB.WithContext(ctx).Save(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update role"})
+		return
+	}
+	if err := config.DB.WithContext(ctx).Model(&role).Association("Permissions").Replace(perms); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update role permissions"})
+		return
+	}
+	utils.InvalidateRolePermissions(ctx, role.Name)
+
+	role.Permissions = perms
+	c.JSON(http.StatusOK, role)
+}
+
+func DeleteRole(c *gin.Context) {
+	ctx := c.Request.Context()
+	name := c.Param("name")
+	if name == models.RoleAdmin || name == models.RoleUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be deleted"})
+		return
+	}
+
+	var role models.Role
+	if err := config.DB.WithContext(ctx).Where("name = ?", name).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	var assigned int64
+	config.DB.WithContext(ctx).Model(&models.User{}).Where("role = ?", name).Count(&assigned)
+	if assigned > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is still assigned to users", "users": assigned})
+		return
+	}
+
+	if err := config.DB.WithContext(ctx).Model(&role).Association("Permissions").Clear(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete role"})
+		return
+	}
+	if err := config.DB.WithContext(ctx).Delete(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete role"})
+		return
+	}
+	utils.InvalidateRolePermissions(ctx, name)
+	c.Status(http.StatusNoContent)
+}
+
+// AssignUserRole changes the role of a user.
+func AssignUserRole(c *gin.Context) {
+	ctx := c.Request.Context()
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	config.DB.WithContext(ctx).Model(&models.Role{}).Where("name = ?", input.Role).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Role does not exist"})
+		return
+	}
+
+	id := c.Param("id")
+	var user models.User
+	if err := config.DB.WithContext(ctx).First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err := config.DB.WithContext(ctx).Model(&user).Update("role", input.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update role"})
+		return
+	}
+	invalidateUserCache(ctx, user.Id)
+	c.JSON(http.StatusOK, &user)
+}
+
+// findPermissions loads the named permissions and reports the names that do not exist.
+func findPermissions(c *gin.Context, names []string) ([]models.Permission, []string) {
+	perms := []models.Permission{}
+	if len(names) == 0 {
+		return perms, nil
+	}
+	config.DB.WithContext(c.Request.Context()).Where("name IN ?", names).Find(&perms)
+
+	found := make(map[string]bool, len(perms))
+	for _, p := range perms {
+		found[p.Name] = true
+	}
+	var missing []string
+	for _, name := range names {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	return perms, missing
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// createSession records a new login with the client's user agent and IP.
+func createSession(c *gin.Context, user models.User) (models.Session, error) {
+	id, err := utils.RandomToken(24)
+	if err != nil {
+		return models.Session{}, err
+	}
+	session := models.Session{
+		ID:         id,
+		UserID:     user.Id,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		LastSeenAt: time.Now(),
+	}
+	err = config.DB.WithContext(c.Request.Context()).Create(&session).Error
+	return session, err
+}
+
+// currentSessionID returns the sid claim of the access token, if any.
+func currentSessionID(c *gin.Context) string {
+	if value, ok := c.Get("claims"); ok {
+		sid, _ := value.(jwt.MapClaims)["sid"].(string)
+		return sid
+	}
+	return ""
+}
+
+// GetSessions lists the current user's active sessions.
+func GetSessions(c *gin.Context) {
+	listSessions(c, c.MustGet("user").(models.User).Id)
+}
+
+// AdminGetSessions lists the active sessions of any user.
+func AdminGetSessions(c *gin.Context) {
+	var user models.User
+	if err := config.DB.WithContext(c.Request.Context()).First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	listSessions(c, user.Id)
+}
+
+func listSessions(c *gin.Context, userID uint) {
+	var sessions []models.Session
+	// Sessions whose refresh tokens have all expired are no longer usable.
+	if err := config.DB.WithContext(c.Request.Context()).
+		Where("user_id = ? AND revoked_at IS NULL AND last_seen_at > ?", userID, time.Now().Add(-RefreshTokenTTL)).
+		Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch sessions"})
+		return
+	}
+
+	current := currentSessionID(c)
+	data := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		data = append(data, gin.H{
+			"id":           s.ID,
+			"user_agent":   s.UserAgent,
+			"ip":           s.IP,
+			"created_at":   s.CreatedAt,
+			"last_seen_at": s.LastSeenAt,
+			"current":      s.ID == current,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// RevokeSession signs the current user out of one of their sessions.
+func RevokeSession(c *gin.Context) {
+	revokeUserSession(c, c.MustGet("user").(models.User).Id)
+}
+
+// AdminRevokeSession signs any user out of one of their sessions.
+func AdminRevokeSession(c *gin.Context) {
+	var user models.User
+	if err := config.DB.WithContext(c.Request.Context()).First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !checkCanManageUser(c, user) {
+		return
+	}
+	revokeUserSession(c, user.Id)
+}
+
+func revokeUserSession(c *gin.Context, userID uint) {
+	ctx := c.Request.Context()
+	var session models.Session
+	if err := config.DB.WithContext(ctx).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("sid"), userID).
+		First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found or already revoked"})
+		return
+	}
+	revokeRefreshFamily(ctx, session.ID)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,369 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+
+	refreshTokenCachePrefix    = "refresh_token:"
+	refreshFamilyRevokedPrefix = "refresh_family_revoked:"
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// generateAccessToken signs a short-lived access token for the given user
+// and session.
+func generateAccessToken(user models.User, sessionID string) (string, error) {
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"sub":  user.Id,                               // Subject (user's ID)
+		"exp":  time.Now().Add(AccessTokenTTL).Unix(), // Expiration time
+		"iat":  time.Now().Unix(),                     // Issued at
+		"jti":  jti,                                   // Token ID, used by the denylist
+		"sid":  sessionID,                             // Session the token belongs to
+		"type": "access",
+	}
+	// องค์กรเริ่มต้นของผู้ใช้ เลือกองค์กรอื่นได้ด้วย header X-Organization-ID
+	var membership models.Membership
+	if config.DB.Where("user_id = ?", user.Id).Order("id").First(&membership).Error == nil {
+		claims["org"] = membership.OrganizationID
+	}
+	return utils.SignToken(claims)
+}
+
+// createRefreshToken stores a new refresh token in the given family and returns
+// the raw value that is handed to the client.
+func createRefreshToken(ctx context.Context, userID uint, familyID string) (string, error) {
+	raw, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	record := models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if err := config.DB.WithContext(ctx).Create(&record).Error; err != nil {
+		return "", err
+	}
+	cacheRefreshToken(ctx, record)
+	return raw, nil
+}
+
+// issueTokenPair starts a new session and writes its access token and first
+// refresh token to the response. The session ID doubles as the refresh
+// token family ID.
+func issueTokenPair(c *gin.Context, user models.User) {
+	session, err := createSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create session"})
+		return
+	}
+	writeTokenPair(c, user, session.ID)
+}
+
+func writeTokenPair(c *gin.Context, user models.User, familyID string) {
+	accessToken, err := generateAccessToken(user, familyID)
+	if errors.Is(err, utils.ErrJWTNotConfigured) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "JWT is not configured on the server."})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	refreshToken, err := createRefreshToken(c.Request.Context(), user.Id, familyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate refresh token"})
+		return
+	}
+
+	response := gin.H{
+		"token":         accessToken, // kept for clients written against the old response
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(AccessTokenTTL.Seconds()),
+		"role":          user.Role,
+	}
+	if config.CookieAuthEnabled() {
+		csrf, err := utils.SetAuthCookies(c, accessToken, refreshToken, AccessTokenTTL, RefreshTokenTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate CSRF token"})
+			return
+		}
+		response["csrf_token"] = csrf
+		// ในโหมด cookie ไม่ส่ง token ใน body เพื่อไม่ให้ JavaScript เข้าถึงได้
+		if config.AuthMode() == config.AuthModeCookie {
+			delete(response, "token")
+			delete(response, "access_token")
+			delete(response, "refresh_token")
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RefreshToken exchanges a valid refresh token for a new access token and a
+// new refresh token. The presented token is consumed; presenting it again
+// revokes every token in its family. In cookie mode the token may come from
+// the refresh cookie instead of the body, which then requires a CSRF token.
+func RefreshToken(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	// body เป็น optional ในโหมด cookie
+	_ = c.ShouldBindJSON(&input)
+	if input.RefreshToken == "" && config.CookieAuthEnabled() {
+		if cookie, err := c.Cookie(utils.RefreshTokenCookie); err == nil && cookie != "" {
+			if !utils.ValidCSRF(c) {
+				utils.AbortWithProblem(c, http.StatusForbidden, "Missing or invalid CSRF token.", gin.H{"reason": "csrf"})
+				return
+			}
+			input.RefreshToken = cookie
+		}
+	}
+	if input.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+		return
+	}
+
+	record, err := rotateRefreshToken(c.Request.Context(), input.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.WithContext(c.Request.Context()).First(&user, record.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User associated with token not found"})
+		return
+	}
+
+	utils.TouchSession(c.Request.Context(), record.FamilyID)
+	writeTokenPair(c, user, record.FamilyID)
+}
+
+// Logout revokes the access token used for this request and ends its
+// session. A refresh_token in the body is revoked as well, which covers
+// tokens issued before sessions were tracked.
+func Logout(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	// body เป็น optional จึงไม่สนใจ error จากการ bind
+	_ = c.ShouldBindJSON(&input)
+
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(models.User)
+	value, ok := c.Get("claims")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only token based sessions can log out; revoke API keys instead"})
+		return
+	}
+	claims := value.(jwt.MapClaims)
+
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if err == nil && exp != nil {
+		if err := utils.RevokeJTI(ctx, jti, user.Id, exp.Time); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke token"})
+			return
+		}
+	}
+
+	// ปิด session ปัจจุบัน ซึ่งจะ revoke refresh token ของ session นี้ไปด้วย
+	if sid, _ := claims["sid"].(string); sid != "" {
+		revokeRefreshFamily(ctx, sid)
+	}
+	if input.RefreshToken != "" {
+		if record, err := findRefreshToken(ctx, utils.HashToken(input.RefreshToken)); err == nil && record.UserID == user.Id {
+			revokeRefreshFamily(ctx, record.FamilyID)
+		}
+	}
+
+	if config.CookieAuthEnabled() {
+		utils.ClearAuthCookies(c)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully."})
+}
+
+// LogoutAll signs the user out everywhere by revoking all of their tokens.
+func LogoutAll(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	if err := revokeUserTokens(c.Request.Context(), user.Id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke tokens"})
+		return
+	}
+	if config.CookieAuthEnabled() {
+		utils.ClearAuthCookies(c)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all sessions."})
+}
+
+// rotateRefreshToken validates the raw refresh token and marks it as used.
+// The update is conditional so two concurrent requests cannot both rotate the
+// same token; the loser is treated as a replay.
+func rotateRefreshToken(ctx context.Context, raw string) (models.RefreshToken, error) {
+	hash := utils.HashToken(raw)
+	record, err := findRefreshToken(ctx, hash)
+	if err != nil {
+		return record, errInvalidRefreshToken
+	}
+
+	if isRefreshFamilyRevoked(ctx, record.FamilyID) || record.RevokedAt != nil {
+		return record, errInvalidRefreshToken
+	}
+	if record.UsedAt != nil {
+		revokeRefreshFamily(ctx, record.FamilyID)
+		log.Printf("SECURITY: refresh token reuse detected for user %d, family %s revoked", record.UserID, record.FamilyID)
+		return record, errRefreshTokenReused
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return record, errInvalidRefreshToken
+	}
+
+	now := time.Now()
+	result := config.DB.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", record.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return record, result.Error
+	}
+	uncacheRefreshToken(ctx, hash)
+	if result.RowsAffected == 0 {
+		revokeRefreshFamily(ctx, record.FamilyID)
+		log.Printf("SECURITY: concurrent refresh token reuse for user %d, family %s revoked", record.UserID, record.FamilyID)
+		return record, errRefreshTokenReused
+	}
+	return record, nil
+}
+
+// findRefreshToken looks the token up in Redis first and falls back to Postgres.
+func findRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error) {
+	var record models.RefreshToken
+	if config.RedisClient != nil {
+		cacheCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		if data, err := config.RedisClient.Get(cacheCtx, refreshTokenCachePrefix+hash).Result(); err == nil {
+			if json.Unmarshal([]byte(data), &record) == nil {
+				return record, nil
+			}
+		}
+	}
+
+	err := config.DB.WithContext(ctx).Where("token_hash = ?", hash).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return record, errInvalidRefreshToken
+	}
+	return record, err
+}
+
+// revokeRefreshFamily revokes every refresh token that descends from the same
+// login, together with the session of that login.
+func revokeRefreshFamily(ctx context.Context, familyID string) {
+	now := time.Now()
+	var hashes []string
+	config.DB.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("family_id = ?", familyID).Pluck("token_hash", &hashes)
+	if err := config.DB.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error; err != nil {
+		log.Printf("ERROR: Failed to revoke refresh token family %s: %v", familyID, err)
+	}
+
+	if err := config.DB.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error; err != nil {
+		log.Printf("ERROR: Failed to revoke session %s: %v", familyID, err)
+	}
+	utils.MarkSessionRevoked(ctx, familyID)
+
+	if config.RedisClient != nil {
+		config.RedisClient.Set(ctx, refreshFamilyRevokedPrefix+familyID, "1", RefreshTokenTTL)
+		for _, hash := range hashes {
+			uncacheRefreshToken(ctx, hash)
+		}
+	}
+}
+
+// revokeUserTokens invalidates every access and refresh token the user holds.
+// Access tokens are cut off through tokens_valid_after rather than one by one.
+func revokeUserTokens(ctx context.Context, userID uint) error {
+	now := time.Now()
+	// callers have already checked access to the user, and revoking must work
+	// whichever organization is selected
+	if err := config.DB.WithContext(config.WithoutTenant(ctx)).Model(&models.User{}).
+		Where("id = ?", userID).Update("tokens_valid_after", now).Error; err != nil {
+		return err
+	}
+	revokeOtherSessions(ctx, userID, "")
+	return nil
+}
+
+// revokeOtherSessions signs the user out everywhere except the session
+// keepSessionID (empty revokes them all).
+func revokeOtherSessions(ctx context.Context, userID uint, keepSessionID string) {
+	var families []string
+	config.DB.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Distinct().Pluck("family_id", &families)
+	var sessions []string
+	config.DB.WithContext(ctx).Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).Pluck("id", &sessions)
+	for _, familyID := range append(families, sessions...) {
+		if familyID != keepSessionID {
+			revokeRefreshFamily(ctx, familyID)
+		}
+	}
+}
+
+func isRefreshFamilyRevoked(ctx context.Context, familyID string) bool {
+	if config.RedisClient == nil {
+		return false
+	}
+	n, err := config.RedisClient.Exists(ctx, refreshFamilyRevokedPrefix+familyID).Result()
+	return err == nil && n > 0
+}
+
+func cacheRefreshToken(ctx context.Context, record models.RefreshToken) {
+	if config.RedisClient == nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	// TokenHash is hidden from JSON, so the key carries it instead.
+	config.RedisClient.Set(ctx, refreshTokenCachePrefix+record.TokenHash, data, time.Until(record.ExpiresAt))
+}
+
+func uncacheRefreshToken(ctx context.Context, hash string) {
+	if config.RedisClient == nil {
+		return
+	}
+	config.RedisClient.Del(ctx, refreshTokenCachePrefix+hash)
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRotateRefreshTokenDetectsReuse(t *testing.T) {
+	useTestDatabase(t)
+	ctx := context.Background()
+	family, _ := utils.RandomToken(12)
+
+	first, err := createRefreshToken(ctx, 1, family)
+	if err != nil {
+		t.Fatalf("createRefreshToken: %v", err)
+	}
+	if _, err := rotateRefreshToken(ctx, first); err != nil {
+		t.Fatalf("first rotation: %v", err)
+	}
+	second, err := createRefreshToken(ctx, 1, family)
+	if err != nil {
+		t.Fatalf("createRefreshToken: %v", err)
+	}
+
+	// Replaying the used token revokes the whole family, so the token it was
+	// rotated into stops working too.
+	if _, err := rotateRefreshToken(ctx, first); !errors.Is(err, errRefreshTokenReused) {
+		t.Fatalf("replayed token: err = %v, want %v", err, errRefreshTokenReused)
+	}
+	if _, err := rotateRefreshToken(ctx, second); !errors.Is(err, errInvalidRefreshToken) {
+		t.Fatalf("token of the revoked family: err = %v, want %v", err, errInvalidRefreshToken)
+	}
+	var active int64
+	config.DB.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", family).Count(&active)
+	if active != 0 {
+		t.Fatalf("%d tokens of the family are still active", active)
+	}
+}
+
+func TestRotateRefreshTokenRejectsInvalidTokens(t *testing.T) {
+	useTestDatabase(t)
+	ctx := context.Background()
+	family, _ := utils.RandomToken(12)
+
+	expired, _ := utils.RandomToken(32)
+	if err := config.DB.Create(&models.RefreshToken{
+		UserID:    1,
+		FamilyID:  family,
+		TokenHash: utils.HashToken(expired),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	revoked, _ := utils.RandomToken(32)
+	revokedAt := time.Now()
+	if err := config.DB.Create(&models.RefreshToken{
+		UserID:    1,
+		FamilyID:  family + "-revoked",
+		TokenHash: utils.HashToken(revoked),
+		ExpiresAt: time.Now().Add(time.Hour),
+		RevokedAt: &revokedAt,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown", "not-a-refresh-token"},
+		{"expired", expired},
+		{"revoked", revoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rotateRefreshToken(ctx, tt.token); !errors.Is(err, errInvalidRefreshToken) {
+				t.Fatalf("err = %v, want %v", err, errInvalidRefreshToken)
+			}
+		})
+	}
+}
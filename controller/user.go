@@ -6,17 +6,16 @@ import (
 	"API/utils"
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"math"
 	"net/http"
-	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -70,7 +69,7 @@ func GetUsers(c *gin.Context) {
 func GetUserID(c *gin.Context) {
 	ctx := c.Request.Context()
 	id := c.Param("id")
-	userCacheKey := "user:" + id // สร้าง cache key เฉพาะสำหรับ user คนนี้
+	userCacheKey := tenantCacheKey(ctx, "user:"+id) // สร้าง cache key เฉพาะสำหรับ user คนนี้ในองค์กรปัจจุบัน
 
 	// ตรวจสอบใน Redis Cache ก่อน
 	if config.RedisClient != nil {
@@ -111,24 +110,119 @@ func GetUserID(c *gin.Context) {
 	})
 }
 
+// SelfUpdateUserInput lists the fields a user may change on their own account.
+type SelfUpdateUserInput struct {
+	Username *string `json:"username"`
+	Name     *string `json:"name"`
+	Email    *string `json:"email"`
+}
+
+// AdminUpdateUserInput lists the fields an administrator may change on any account.
+type AdminUpdateUserInput struct {
+	SelfUpdateUserInput
+	Role *string `json:"role"`
+}
+
+var (
+	selfUpdatableFields  = []string{"username", "name", "email"}
+	adminUpdatableFields = []string{"username", "name", "email", "role"}
+)
+
 func UpdateUser(c *gin.Context) {
+	ctx := c.Request.Context()
 	var user models.User
 	id := c.Param("id")
 
-	if err := config.DB.First(&user, id).Error; err != nil {
+	if err := config.DB.WithContext(ctx).First(&user, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
-	if err := c.BindJSON(&user); err != nil {
+
+	// เจ้าของบัญชีแก้ไขได้เฉพาะของตัวเอง ส่วนผู้ดูแลระบบแก้ไขได้ทุกบัญชี
+	caller := c.MustGet("user").(models.User)
+	isAdmin := callerHasPermission(c, caller, models.PermUsersAdmin)
+	if caller.Id != user.Id && !isAdmin {
+		utils.AbortWithProblem(c, http.StatusForbidden, "You can only update your own account.", gin.H{"missing_permission": models.PermUsersAdmin})
+		return
+	}
+
+	// การแก้บัญชีตัวเอง (เช่นเปลี่ยนอีเมล) ต้อง login เอง เหมือน PATCH /me
+	if caller.Id == user.Id && rejectAPIKeyAuth(c) {
+		return
+	}
+	if !checkCanManageUser(c, user) {
+		return
+	}
+
+	allowed := selfUpdatableFields
+	if isAdmin {
+		allowed = adminUpdatableFields
+	}
+	updateUser(c, user, allowed)
+}
+
+// updateUser applies a partial update limited to the allowed fields. It is
+// shared by PUT /users/:id and PATCH /me.
+func updateUser(c *gin.Context, user models.User, allowed []string) {
+	ctx := c.Request.Context()
+	body, err := c.GetRawData()
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	config.DB.Save(&user)
-	if config.RedisClient != nil {
+	if ok := checkUpdateFields(c, body, allowed); !ok {
+		return
+	}
 
-		ctx := c.Request.Context()
-		go config.RedisClient.Del(ctx, "user:"+id)
+	var input AdminUpdateUserInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Username != nil {
+		updates["username"] = *input.Username
+	}
+	if input.Name != nil {
+		updates["name"] = *input.Name
+	}
+	if input.Email != nil && *input.Email != user.Email {
+		if *input.Email == "" {
+			utils.AbortWithProblem(c, http.StatusUnprocessableEntity, "email cannot be empty.", gin.H{"fields": []string{"email"}})
+			return
+		}
+		updates["email"] = *input.Email
+		updates["email_verified_at"] = nil
+	}
+	if input.Role != nil && *input.Role != user.Role {
+		// global role เปลี่ยนได้เฉพาะผู้ที่มี roles:admin ไม่ใช่แค่ผู้ดูแลขององค์กร
+		if !callerHasPermission(c, c.MustGet("user").(models.User), models.PermRolesAdmin) {
+			utils.AbortWithProblem(c, http.StatusForbidden, "You are not allowed to change these fields.", gin.H{"fields": []string{"role"}, "missing_permission": models.PermRolesAdmin})
+			return
+		}
+		if !roleExists(ctx, *input.Role) {
+			utils.AbortWithProblem(c, http.StatusUnprocessableEntity, "Role does not exist.", gin.H{"fields": []string{"role"}})
+			return
+		}
+		updates["role"] = *input.Role
+	}
 
+	if len(updates) > 0 {
+		updateCtx := ctx
+		if user.Id == c.MustGet("user").(models.User).Id {
+			updateCtx = ownAccountContext(c)
+		}
+		if err := config.DB.WithContext(updateCtx).Model(&user).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Could not update user: " + err.Error()})
+			return
+		}
+	}
+	if _, changed := updates["email"]; changed {
+		sendVerificationEmail(user)
+	}
+	invalidateUserCache(ctx, user.Id)
+	if config.RedisClient != nil {
 		// Publish update event
 		updateMsg, _ := json.Marshal(gin.H{"event": "user_updated", "user_id": user.Id})
 		go config.RedisClient.Publish(c.Request.Context(), "user_updates", updateMsg)
@@ -137,12 +231,94 @@ func UpdateUser(c *gin.Context) {
 	c.JSON(http.StatusOK, &user)
 }
 
+// checkUpdateFields rejects a JSON body that contains fields outside of the
+// caller's whitelist: 403 for fields only an administrator may set, 422 for
+// fields that cannot be set through this endpoint at all.
+func checkUpdateFields(c *gin.Context, body []byte, allowed []string) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request body must be a JSON object"})
+		return false
+	}
+
+	var forbidden, unknown []string
+	for name := range fields {
+		switch {
+		case slices.Contains(allowed, name):
+		case slices.Contains(adminUpdatableFields, name):
+			forbidden = append(forbidden, name)
+		default:
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(forbidden)
+	sort.Strings(unknown)
+
+	if len(forbidden) > 0 {
+		utils.AbortWithProblem(c, http.StatusForbidden, "You are not allowed to change these fields.", gin.H{"fields": forbidden})
+		return false
+	}
+	if len(unknown) > 0 {
+		utils.AbortWithProblem(c, http.StatusUnprocessableEntity, "These fields cannot be updated.", gin.H{"fields": unknown, "allowed_fields": allowed})
+		return false
+	}
+	return true
+}
+
+// callerHasPermission checks a permission for the user set by RequireAuth,
+// reusing the permissions RequirePermission may already have loaded.
+func callerHasPermission(c *gin.Context, caller models.User, permission string) bool {
+	perms, exists := c.Get("permissions")
+	if !exists {
+		loaded, err := utils.RolePermissions(c.Request.Context(), caller.Role)
+		if err != nil {
+			return false
+		}
+		c.Set("permissions", loaded)
+		perms = loaded
+	}
+	if !utils.HasPermission(perms.([]string), permission) {
+		return false
+	}
+	// API keys are further limited to the scopes they were created with.
+	if scopes, scoped := c.Get("api_key_scopes"); scoped {
+		return utils.HasPermission(scopes.([]string), permission)
+	}
+	return true
+}
+
+// checkCanManageUser answers 403 unless the caller holds every permission of
+// the target's global role, so nobody can take over an account more
+// privileged than their own. Acting on oneself is always allowed.
+func checkCanManageUser(c *gin.Context, target models.User) bool {
+	caller := c.MustGet("user").(models.User)
+	if caller.Id == target.Id {
+		return true
+	}
+	targetPerms, err := utils.RolePermissions(c.Request.Context(), target.Role)
+	if err != nil {
+		// an unknown role grants nothing
+		return true
+	}
+	for _, p := range targetPerms {
+		if !callerHasPermission(c, caller, p) {
+			utils.AbortWithProblem(c, http.StatusForbidden, "The user has permissions you do not have.", gin.H{"missing_permission": p})
+			return false
+		}
+	}
+	return true
+}
+
+// CreateUser handles /register. Depending on config.RegistrationMode it is
+// open to anyone, needs an invitation token or is closed. An invitation sets
+// the account's role and counts as a verified email address.
 func CreateUser(c *gin.Context) {
 	var input struct {
-		Username string `json:"username"`
-		Name     string `json:"name"`
-		Email    string `json:"email" binding:"required"`
-		Password string `json:"password" binding:"required"`
+		Username    string `json:"username"`
+		Name        string `json:"name"`
+		Email       string `json:"email" binding:"required"`
+		Password    string `json:"password" binding:"required"`
+		InviteToken string `json:"invite_token"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -150,50 +326,180 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	switch config.RegistrationMode() {
+	case config.RegistrationClosed:
+		utils.AbortWithProblem(c, http.StatusForbidden, "Registration is closed.", gin.H{"reason": "registration_closed"})
+		return
+	case config.RegistrationInvite:
+		if input.InviteToken == "" {
+			utils.AbortWithProblem(c, http.StatusForbidden, "Registration requires an invitation.", gin.H{"reason": "invitation_required"})
+			return
+		}
+	}
+
+	var invitation *models.Invitation
+	if input.InviteToken != "" {
+		found, ok := findInvitation(c.Request.Context(), input.InviteToken, input.Email)
+		if !ok {
+			utils.AbortWithProblem(c, http.StatusForbidden, "The invitation is invalid, has expired or was sent to another email address.", gin.H{"reason": "invitation_invalid"})
+			return
+		}
+		invitation = &found
+	}
+
+	if !checkPasswordPolicy(c, input.Password, input.Email, input.Username) {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
 
-	user := models.User{Username: input.Username, Name: input.Name, Email: input.Email, PasswordHash: string(hashedPassword)}
-	result := config.DB.Create(&user)
-	if result.Error != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Could not create user :" + result.Error.Error()})
+	user := models.User{Username: input.Username, Name: input.Name, Email: input.Email, Role: models.RoleUser, PasswordHash: hashedPassword}
+	if invitation != nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		if invitation.OrganizationID == 0 {
+			user.Role = invitation.Role
+		}
+	}
+
+	// การใช้ invitation และการสร้างผู้ใช้ต้องสำเร็จหรือล้มเหลวไปพร้อมกัน
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if invitation != nil {
+			result := tx.Model(invitation).Where("accepted_at IS NULL").Update("accepted_at", time.Now())
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errInvitationUsed
+			}
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if invitation == nil {
+			return nil
+		}
+		if invitation.OrganizationID != 0 {
+			membership := models.Membership{OrganizationID: invitation.OrganizationID, UserID: user.Id, Role: invitation.Role}
+			if err := tx.Create(&membership).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(invitation).Update("accepted_by", user.Id).Error
+	})
+	if errors.Is(err, errInvitationUsed) {
+		utils.AbortWithProblem(c, http.StatusForbidden, "The invitation has already been used.", gin.H{"reason": "invitation_invalid"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Could not create user :" + err.Error()})
 		return
 	}
 	if config.RedisClient != nil {
 		// Nonting
 	}
+	if !user.EmailVerified() {
+		sendVerificationEmail(user)
+	}
+	c.JSON(http.StatusCreated, &user)
+}
+
+// AdminCreateUser lets an administrator create an account directly, which is
+// the only way to add users while registration is closed. Inside an
+// organization the user becomes a member and role is the membership role;
+// otherwise role is the global role.
+func AdminCreateUser(c *gin.Context) {
+	ctx := c.Request.Context()
+	var input struct {
+		Username string `json:"username"`
+		Name     string `json:"name"`
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password" binding:"required"`
+		Role     string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantID, scoped := config.TenantFromContext(ctx)
+	inOrganization := scoped && tenantID != 0
+	if input.Role == "" {
+		input.Role = models.RoleUser
+		if inOrganization {
+			input.Role = models.RoleOrgMember
+		}
+	}
+	if !checkAssignableRole(c, input.Role) {
+		return
+	}
+	if !checkPasswordPolicy(c, input.Password, input.Email, input.Username) {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	user := models.User{Username: input.Username, Name: input.Name, Email: input.Email, Role: input.Role, PasswordHash: hashedPassword}
+	if inOrganization {
+		user.Role = models.RoleUser
+	}
+	err = config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if inOrganization {
+			return tx.Create(&models.Membership{UserID: user.Id, Role: input.Role}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Could not create user :" + err.Error()})
+		return
+	}
+	sendVerificationEmail(user)
 	c.JSON(http.StatusCreated, &user)
 }
 
+// DeleteUser deletes a global account, which also removes it from every
+// organization. It needs users:admin, which only platform administrators
+// hold; organization admins remove a member from their organization with
+// DELETE /members/:userId instead.
 func DeleteUser(c *gin.Context) {
+	ctx := c.Request.Context()
 	var user models.User
-	result := config.DB.Where("id = ?", c.Param("id")).Delete(&user)
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"message": "User not found or already deleted."})
-		id := c.Param("id")
 
-		// It's better to find the user first to ensure it exists.
-		if err := config.DB.First(&user, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"message": "User not found."})
-			return
-		}
+	// It's better to find the user first to ensure it exists in the current organization.
+	if err := config.DB.WithContext(ctx).First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found or already deleted."})
+		return
+	}
+	if !checkCanManageUser(c, user) {
+		return
+	}
+	invalidateUserCache(ctx, user.Id)
 
-		// Now delete the user
-		if err := config.DB.Delete(&user).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to delete user."})
-			return
-		}
-		if config.RedisClient != nil {
-			ctx := c.Request.Context()
-			go config.RedisClient.Del(ctx, "user:"+id)
+	// Now delete the user and their memberships in every organization
+	err := config.DB.WithContext(config.WithoutTenant(ctx)).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.Id).Delete(&models.Membership{}).Error; err != nil {
+			return err
 		}
-		c.JSON(http.StatusNoContent, nil)
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to delete user."})
+		return
 	}
+	c.Status(http.StatusNoContent)
 }
 
+const PasswordResetTTL = 15 * time.Minute
+
 type LoginInput struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
@@ -209,39 +515,37 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	email := normalizeLoginEmail(input.Email)
+	if err := config.DB.Where("LOWER(email) = ?", email).First(&user).Error; err != nil {
+		// อีเมลที่ไม่มีในระบบก็ถูกนับและหน่วงเวลาเหมือนกัน เพื่อไม่ให้เดาได้ว่ามีบัญชีหรือไม่
+		if checkLoginAllowed(c, email, nil) {
+			recordLoginFailure(c, email, nil)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		}
 		return
 	}
-
-	err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password))
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	if !checkLoginAllowed(c, email, &user) {
 		return
 	}
 
-	claims := jwt.MapClaims{
-		"sub": user.Id,                               // Subject (user's ID)
-		"exp": time.Now().Add(time.Hour * 24).Unix(), // Expiration time (24 hours)
-		"iat": time.Now().Unix(),                     // Issued at
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "JWT is not configured on the server."})
+	ok, needsRehash := utils.VerifyPassword(user.PasswordHash, input.Password)
+	if !ok {
+		recordLoginFailure(c, email, &user)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
+	recordLoginSuccess(c, email, &user)
+	if needsRehash {
+		rehashPassword(c, user, input.Password)
+	}
 
-	t, err := token.SignedString([]byte(jwtSecret))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+	if !user.EmailVerified() && config.EmailVerificationPolicy() == config.EmailVerificationStrict {
+		utils.AbortWithProblem(c, http.StatusForbidden, "Verify your email address before logging in.", gin.H{"reason": "email_not_verified"})
 		return
 	}
 
-	// ส่ง token กลับไป
-	c.JSON(http.StatusOK, gin.H{"token": t, "role": user.Role})
+	// ส่ง access token และ refresh token กลับไป (หรือ challenge ถ้าเปิดใช้ 2FA)
+	completeLogin(c, user)
 }
 
 func ForgotPassword(c *gin.Context) {
@@ -254,32 +558,29 @@ func ForgotPassword(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := config.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+	user, ok := emailLinkRecipient(input.Email)
+	if !ok {
 		c.JSON(http.StatusOK, gin.H{"message": "If an account with that email exists, a password reset link has been sent."})
 		return
 	}
 
-	// Generate a JWT token for password reset
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":  user.Id,
-		"exp":  time.Now().Add(15 * time.Minute).Unix(),
-		"type": "reset_password",
-	})
-
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "JWT secret not configured"})
+	// Generate a single-use reset token. Only its hash is stored, and storing
+	// it replaces any token requested earlier.
+	tokenString, err := utils.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
-
-	tokenString, err := token.SignedString([]byte(jwtSecret))
-	if err != nil {
+	expires := time.Now().Add(PasswordResetTTL)
+	if err := config.DB.Model(&user).Updates(map[string]interface{}{
+		"password_reset_token":   utils.HashToken(tokenString),
+		"password_reset_expires": expires,
+	}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	// Send the JWT token to the user's email.
+	// Send the reset token to the user's email.
 	if err := utils.SendPasswordResetEmail(user.Email, tokenString); err != nil {
 		log.Printf("CRITICAL: Failed to send password reset email to %s: %v", user.Email, err)
 	}
@@ -287,6 +588,61 @@ func ForgotPassword(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "If an account with that email exists, a password reset link has been sent."})
 }
 
+// emailLinkRecipient finds the user a reset or sign-in link may be emailed
+// to. Callers answer exactly the same way when it returns false, so the
+// response does not reveal whether an account exists.
+func emailLinkRecipient(email string) (models.User, bool) {
+	var user models.User
+	if err := config.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		return user, false
+	}
+	// ไม่ส่งอีเมลไปยังที่อยู่ที่ยังไม่ได้ยืนยัน
+	if !user.EmailVerified() && config.EmailVerificationPolicy() != config.EmailVerificationOff {
+		return user, false
+	}
+	return user, true
+}
+
+// rehashPassword replaces a hash made with an old algorithm or outdated
+// parameters after a successful login, while the plain password is known.
+// The update is conditional so a concurrent password change is not undone.
+func rehashPassword(c *gin.Context, user models.User, password string) {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("ERROR: Failed to rehash password of user %d: %v", user.Id, err)
+		return
+	}
+	if err := config.DB.WithContext(c.Request.Context()).Model(&models.User{}).
+		Where("id = ? AND password_hash = ?", user.Id, user.PasswordHash).
+		Update("password_hash", hash).Error; err != nil {
+		log.Printf("ERROR: Failed to store rehashed password of user %d: %v", user.Id, err)
+	}
+}
+
+// passwordChangeUpdates returns the columns to write when a password changes.
+// Any outstanding reset token is invalidated at the same time.
+func passwordChangeUpdates(passwordHash string) map[string]interface{} {
+	return map[string]interface{}{
+		"password_hash":          passwordHash,
+		"password_reset_token":   "",
+		"password_reset_expires": nil,
+	}
+}
+
+// checkPasswordPolicy answers 422 with every violated rule when the password
+// does not satisfy the configured policy.
+func checkPasswordPolicy(c *gin.Context, password string, identifiers ...string) bool {
+	violations := utils.ValidatePassword(password, identifiers...)
+	if len(violations) == 0 {
+		return true
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":      "Password does not meet the password policy",
+		"violations": violations,
+	})
+	return false
+}
+
 // ResetPassword handles the logic for resetting a password with a valid token.
 func ResetPassword(c *gin.Context) {
 	var input struct {
@@ -299,45 +655,42 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	token, err := jwt.Parse(input.Token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(jwtSecret), nil
-	})
-
-	if err != nil || !token.Valid {
+	tokenHash := utils.HashToken(input.Token)
+	var foundUser models.User
+	if err := config.DB.Where("password_reset_token = ? AND password_reset_expires > ?", tokenHash, time.Now()).First(&foundUser).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
 		return
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || claims["type"] != "reset_password" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token type"})
-		return
-	}
-
-	// Extract user ID from claims
-	userID := uint(claims["sub"].(float64))
-	var foundUser models.User
-	if err := config.DB.First(&foundUser, userID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+	if !checkPasswordPolicy(c, input.Password, foundUser.Email, foundUser.Username) {
 		return
 	}
 
 	// Hash the new password
-	newHashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	newHashedPassword, err := utils.HashPassword(input.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash new password"})
 		return
 	}
 
-	// Update only the password_hash field
-	if err := config.DB.Model(&foundUser).Update("password_hash", string(newHashedPassword)).Error; err != nil {
+	// Consume the token and set the password in one conditional update, so a
+	// token can only ever be used once even by concurrent requests.
+	result := config.DB.Model(&models.User{}).
+		Where("id = ? AND password_reset_token = ?", foundUser.Id, tokenHash).
+		Updates(passwordChangeUpdates(newHashedPassword))
+	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	// Changing the password signs the user out of every existing session.
+	if err := revokeUserTokens(c.Request.Context(), foundUser.Id); err != nil {
+		log.Printf("ERROR: Failed to revoke tokens for user %d after password reset: %v", foundUser.Id, err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset successfully."})
 }
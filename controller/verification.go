@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const EmailVerificationTTL = 24 * time.Hour
+
+// sendVerificationEmail emails a signed link for the user's current address.
+// The address is part of the token, so changing it invalidates older links.
+func sendVerificationEmail(user models.User) {
+	token, err := utils.SignToken(jwt.MapClaims{
+		"sub":   user.Id,
+		"email": user.Email,
+		"exp":   time.Now().Add(EmailVerificationTTL).Unix(),
+		"type":  "email_verification",
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to sign verification token for user %d: %v", user.Id, err)
+		return
+	}
+	if err := utils.SendVerificationEmail(user.Email, token); err != nil {
+		log.Printf("CRITICAL: Failed to send verification email to %s: %v", user.Email, err)
+	}
+}
+
+// VerifyEmail marks the address as verified. The token is accepted as a
+// query parameter (the emailed link) or in a JSON body.
+func VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		var input struct {
+			Token string `json:"token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		token = input.Token
+	}
+
+	claims, err := utils.ParseToken(token)
+	if err != nil || claims["type"] != "email_verification" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var user models.User
+	if err := config.DB.WithContext(ctx).First(&user, claims["sub"]).Error; err != nil || user.Email != claims["email"] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if user.EmailVerified() {
+		c.JSON(http.StatusOK, gin.H{"message": "Email address is already verified."})
+		return
+	}
+
+	if err := config.DB.WithContext(ctx).Model(&user).Update("email_verified_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify email"})
+		return
+	}
+	if config.RedisClient != nil {
+		go config.RedisClient.Del(ctx, fmt.Sprintf("user:%d", user.Id))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email address verified."})
+}
+
+// ResendVerificationEmail sends a new link. Like ForgotPassword it answers
+// the same way whether or not the address exists.
+func ResendVerificationEmail(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.WithContext(c.Request.Context()).Where("email = ?", input.Email).First(&user).Error; err == nil && !user.EmailVerified() {
+		sendVerificationEmail(user)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If an unverified account with that email exists, a verification link has been sent."})
+}
@@ -4,7 +4,11 @@ import (
 	"API/config"
 	"API/controller"
 	"API/middleware"
+	"API/models"
+	"API/utils"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,22 +17,46 @@ func main() {
 	// router := gin.New()
 	config.Connection()
 	config.InitRedis()
+	// load the JWT signing keys and password hashing settings up front so configuration errors show at startup
+	if _, err := utils.Keys(); err != nil {
+		log.Fatalf("FATAL: Failed to load JWT keys: %v", err)
+	}
+	utils.PasswordHashers()
+	go controller.StartErasureWorker(time.Hour)
 	// routes.UserRoute(router)
 	// routes.ProductRoute(router)
 
 	router := gin.Default()
-	router.Use(middleware.CORSMiddleware())
-	router.POST("/login", middleware.RateLimiter(), controller.Login)
-	router.POST("/register", middleware.RateLimiter(), controller.CreateUser)
-	router.POST("/forgot-password", middleware.RateLimiter(), controller.ForgotPassword)
-	router.POST("/reset-password", middleware.RateLimiter(), controller.ResetPassword)
+	router.Use(middleware.CORSMiddleware(), middleware.ConcurrencyLimit("global"))
+	router.POST("/login", middleware.RateLimit("login"), controller.Login)
+	router.POST("/register", middleware.RateLimit("register"), controller.CreateUser)
+	router.POST("/forgot-password", middleware.RateLimit("password_reset"), controller.ForgotPassword)
+	router.POST("/reset-password", middleware.RateLimit("password_reset"), controller.ResetPassword)
+	router.GET("/verify-email", controller.VerifyEmail)
+	router.POST("/verify-email", controller.VerifyEmail)
+	router.POST("/verify-email/resend", middleware.RateLimit("verify_email"), controller.ResendVerificationEmail)
+	router.GET("/unlock-account", controller.UnlockAccount)
+	router.POST("/login/mfa", middleware.RateLimit("login"), controller.LoginMFA)
+	// /login/magic ใช้ rate limit เดียวกับ /forgot-password
+	router.POST("/login/magic", middleware.RateLimit("password_reset"), controller.RequestMagicLink)
+	router.POST("/login/magic/verify", middleware.RateLimit("login"), controller.VerifyMagicLink)
+	router.POST("/token/refresh", middleware.RateLimit("refresh"), controller.RefreshToken)
+	router.GET("/auth/oidc/providers", controller.GetOIDCProviders)
+	router.GET("/auth/oidc/:provider/login", controller.OIDCLogin)
+	router.GET("/auth/oidc/:provider/callback", controller.OIDCCallback)
+	router.GET("/.well-known/jwks.json", controller.JWKS)
 	// Note: The route below also creates a user, but without a rate limit.
 	// Consider removing it in favor of the /register endpoint.
 	// router.POST("/users", controller.CreateUser)
 
 	authorized := router.Group("/")
-	authorized.Use(middleware.RequireAuth)
+	authorized.Use(middleware.RequireAuth, middleware.ConcurrencyLimit("api"), middleware.ResolveTenant, middleware.AuditImpersonation, middleware.RateLimit("api"))
 	{
+		// /me/usage is registered before Quota is added to the group, so
+		// clients can check their usage after a quota is used up.
+		authorized.GET("/me/usage", controller.GetUsage)
+		authorized.Use(middleware.Quota())
+
 		authorized.GET("/", func(c *gin.Context) {
 			user, exist := c.Get("user")
 			if !exist {
@@ -40,15 +68,67 @@ func main() {
 				"user":    user,
 			})
 		})
-		authorized.GET("/users", controller.GetUsers)
-		authorized.GET("/users/:id", controller.GetUserID)
-		authorized.PUT("/users/:id", controller.UpdateUser)
-		authorized.DELETE("/users/:id", controller.DeleteUser)
-		authorized.GET("/products", controller.GetProducts)
-		authorized.GET("/products/:id", controller.GetProductByID)
-		authorized.POST("/products", controller.CreateProduct)
-		authorized.PUT("/products/:id", controller.UpdateProduct)
-		authorized.DELETE("/products/:id", controller.DeleteProduct)
+		// บัญชีของตัวเองจัดการได้เฉพาะเมื่อ login เอง ไม่ใช่ผ่าน API key
+		account := authorized.Group("/", middleware.RejectAPIKey)
+		account.POST("/logout", controller.Logout)
+		account.POST("/logout-all", controller.LogoutAll)
+		account.POST("/mfa/totp/enroll", controller.EnrollTOTP)
+		account.GET("/mfa/totp/qr", controller.TOTPQRCode)
+		account.POST("/mfa/totp/confirm", controller.ConfirmTOTP)
+		account.POST("/mfa/totp/disable", controller.DisableTOTP)
+		account.POST("/mfa/recovery-codes", controller.RegenerateRecoveryCodes)
+		account.GET("/me", controller.GetMe)
+		account.PATCH("/me", controller.UpdateMe)
+		account.POST("/me/password", middleware.RateLimit("change_password"), controller.ChangePassword)
+		account.DELETE("/me", controller.DeleteMe)
+		account.GET("/me/organizations", controller.GetMyOrganizations)
+		account.POST("/me/exports", controller.RequestDataExport)
+		account.GET("/me/exports", controller.GetDataExports)
+		account.GET("/me/exports/:exportId/download", controller.DownloadDataExport)
+		account.POST("/me/erasure", controller.RequestErasure)
+		account.DELETE("/me/erasure", controller.CancelErasure)
+		account.GET("/sessions", controller.GetSessions)
+		account.DELETE("/sessions/:sid", controller.RevokeSession)
+		account.POST("/api-keys", controller.CreateAPIKey)
+		account.GET("/api-keys", controller.GetAPIKeys)
+		account.DELETE("/api-keys/:keyId", controller.RevokeAPIKey)
+		authorized.GET("/users", middleware.RequirePermission(models.PermUsersRead), controller.GetUsers)
+		authorized.POST("/users", middleware.RequirePermission(models.PermUsersAdmin), controller.AdminCreateUser)
+		authorized.POST("/invitations", middleware.RequirePermission(models.PermUsersAdmin), controller.CreateInvitation)
+		authorized.GET("/invitations", middleware.RequirePermission(models.PermUsersAdmin), controller.GetInvitations)
+		authorized.DELETE("/invitations/:inviteId", middleware.RequirePermission(models.PermUsersAdmin), controller.RevokeInvitation)
+		authorized.GET("/users/:id", middleware.RequirePermission(models.PermUsersRead), controller.GetUserID)
+		authorized.PUT("/users/:id", controller.UpdateUser) // owner or users:admin, checked in the handler
+		// users:admin is platform-only; org admins remove members with DELETE /members/:userId
+		authorized.DELETE("/users/:id", middleware.RequirePermission(models.PermUsersAdmin), controller.DeleteUser)
+		authorized.POST("/users/:id/unlock", middleware.RequirePermission(models.PermUsersAdmin), controller.AdminUnlockUser)
+		authorized.GET("/users/:id/security-events", middleware.RequirePermission(models.PermUsersAdmin), controller.GetUserSecurityEvents)
+		authorized.POST("/users/:id/api-keys", middleware.RequirePermission(models.PermUsersAdmin), controller.AdminCreateAPIKey)
+		authorized.GET("/users/:id/api-keys", middleware.RequirePermission(models.PermUsersAdmin), controller.AdminGetAPIKeys)
+		authorized.DELETE("/users/:id/api-keys/:keyId", middleware.RequirePermission(models.PermUsersAdmin), controller.AdminRevokeAPIKey)
+		authorized.GET("/users/:id/sessions", middleware.RequirePermission(models.PermUsersAdmin), controller.AdminGetSessions)
+		authorized.DELETE("/users/:id/sessions/:sid", middleware.RequirePermission(models.PermUsersAdmin), controller.AdminRevokeSession)
+		authorized.POST("/users/:id/impersonate", middleware.RequirePermission(models.PermUsersImpersonate), controller.Impersonate)
+		authorized.GET("/audit-logs", middleware.RequirePermission(models.PermUsersAdmin), controller.GetAuditLogs)
+		authorized.PUT("/users/:id/role", middleware.RequirePermission(models.PermRolesAdmin), controller.AssignUserRole)
+		authorized.GET("/products", middleware.RequirePermission(models.PermProductsRead), controller.GetProducts)
+		authorized.GET("/products/:id", middleware.RequirePermission(models.PermProductsRead), controller.GetProductByID)
+		authorized.POST("/products", middleware.RequirePermission(models.PermProductsWrite), middleware.RequireVerifiedEmail, controller.CreateProduct)
+		authorized.PUT("/products/:id", middleware.RequirePermission(models.PermProductsWrite), middleware.RequireVerifiedEmail, controller.UpdateProduct)
+		authorized.DELETE("/products/:id", middleware.RequirePermission(models.PermProductsWrite), middleware.RequireVerifiedEmail, controller.DeleteProduct)
+		authorized.POST("/organizations", middleware.RequirePermission(models.PermOrgsAdmin), controller.CreateOrganization)
+		authorized.GET("/organizations", middleware.RequirePermission(models.PermOrgsAdmin), controller.GetOrganizations)
+		authorized.GET("/members", middleware.RequirePermission(models.PermUsersRead), controller.GetMembers)
+		authorized.POST("/members", middleware.RequirePermission(models.PermMembersAdmin), controller.AddMember)
+		authorized.PUT("/members/:userId", middleware.RequirePermission(models.PermMembersAdmin), controller.UpdateMember)
+		authorized.DELETE("/members/:userId", middleware.RequirePermission(models.PermMembersAdmin), controller.RemoveMember)
+
+		authorized.GET("/permissions", middleware.RequirePermission(models.PermRolesAdmin), controller.GetPermissions)
+		authorized.GET("/roles", middleware.RequirePermission(models.PermRolesAdmin), controller.GetRoles)
+		authorized.POST("/roles", middleware.RequirePermission(models.PermRolesAdmin), controller.CreateRole)
+		authorized.PUT("/roles/:name", middleware.RequirePermission(models.PermRolesAdmin), controller.UpdateRole)
+		authorized.DELETE("/roles/:name", middleware.RequirePermission(models.PermRolesAdmin), controller.DeleteRole)
+		authorized.POST("/keys/rotate", middleware.RequirePermission(models.PermKeysAdmin), controller.RotateSigningKey)
 	}
 
 	router.Run(":8080")
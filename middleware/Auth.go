@@ -3,10 +3,12 @@ package middleware
 import (
 	"API/config"
 	"API/models"
-	"fmt"
+	"API/utils"
+	"crypto/subtle"
+	"errors"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -14,52 +16,161 @@ import (
 
 func RequireAuth(c *gin.Context) {
 	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" && config.CookieAuthEnabled() {
+		// โหมด cookie: ใช้ access token จาก cookie และต้องมี CSRF token สำหรับ method ที่แก้ไขข้อมูล
+		if cookie, err := c.Cookie(utils.AccessTokenCookie); err == nil && cookie != "" {
+			if !utils.ValidCSRF(c) {
+				utils.AbortWithProblem(c, http.StatusForbidden, "Missing or invalid CSRF token.", gin.H{"reason": "csrf"})
+				return
+			}
+			authHeader = "Bearer " + cookie
+		}
+	}
 	if authHeader == "" {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
 		return
 	}
 
+	if apiKey, ok := strings.CutPrefix(authHeader, "ApiKey "); ok {
+		requireAPIKey(c, strings.TrimSpace(apiKey))
+		return
+	}
+
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	if tokenString == authHeader {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format, must be 'Bearer <token>'"})
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format, must be 'Bearer <token>' or 'ApiKey <key>'"})
 		return
 	}
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
+	claims, err := utils.ParseToken(tokenString)
+	if errors.Is(err, utils.ErrJWTNotConfigured) {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "JWT is not configured on the server."})
 		return
 	}
-
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(jwtSecret), nil
-	})
-
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 		return
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// ดึง User ID จาก claim 'sub'
-		sub, ok := claims["sub"] // JWT parse ตัวเลขเป็น float64
+	// token ชนิดอื่น (เช่น mfa_challenge) หรือ token ที่ไม่ระบุชนิด ห้ามนำมาใช้แทน access token
+	if claims["type"] != "access" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	// ดึง User ID จาก claim 'sub'
+	sub, ok := claims["sub"] // JWT parse ตัวเลขเป็น float64
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token"})
+		return
+	}
+
+	// ตรวจสอบว่า token นี้ถูก revoke ไปแล้วหรือยัง (เช่น หลังจาก /logout)
+	jti, _ := claims["jti"].(string)
+	if utils.IsJTIRevoked(c.Request.Context(), jti) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+		return
+	}
+
+	// session ที่ถูก revoke แล้ว (ผ่าน /sessions หรือ /logout) ใช้ token เดิมต่อไม่ได้
+	sid, _ := claims["sid"].(string)
+	if utils.IsSessionRevoked(c.Request.Context(), sid) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return
+	}
+
+	var user models.User
+	// ค้นหาผู้ใช้ในฐานข้อมูลเพื่อให้แน่ใจว่าผู้ใช้ยังมีตัวตนอยู่
+	if err := config.DB.First(&user, sub).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User associated with token not found"})
+		return
+	}
+
+	// token ที่ออกก่อนหรือในวินาทีเดียวกับ tokens_valid_after (เช่น หลัง /logout-all หรือเปลี่ยนรหัสผ่าน) ถือว่าใช้ไม่ได้
+	if issuedBeforeRevocation(claims, user.TokensValidAfter) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+		return
+	}
+
+	// token สวมรอย (impersonation) มี claim "act" ระบุผู้ดูแลระบบที่ใช้งานจริง
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		actor, ok := impersonationActor(c, act, claims)
 		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Impersonation is no longer allowed"})
 			return
 		}
+		c.Set("actor", actor)
+	}
 
-		var user models.User
-		// ค้นหาผู้ใช้ในฐานข้อมูลเพื่อให้แน่ใจว่าผู้ใช้ยังมีตัวตนอยู่
-		if err := config.DB.First(&user, sub).Error; err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User associated with token not found"})
-			return
-		}
-		// แนบข้อมูลผู้ใช้ไปกับ Context เพื่อให้ Handler อื่นๆ นำไปใช้ได้
-		c.Set("user", user)
-		c.Next()
-	} else {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+	// แนบข้อมูลผู้ใช้ไปกับ Context เพื่อให้ Handler อื่นๆ นำไปใช้ได้
+	c.Set("user", user)
+	c.Set("claims", claims)
+	c.Set("auth_method", "jwt")
+	utils.TouchSession(c.Request.Context(), sid)
+	c.Next()
+}
+
+// issuedBeforeRevocation reports whether the token was issued at or before
+// tokensValidAfter. iat only has whole seconds, so a token issued in the same
+// second as the revocation counts as revoked; otherwise a token issued just
+// before it would stay valid. Tokens without iat count as revoked too.
+func issuedBeforeRevocation(claims jwt.MapClaims, tokensValidAfter *time.Time) bool {
+	if tokensValidAfter == nil {
+		return false
+	}
+	iat, err := claims.GetIssuedAt()
+	return err != nil || iat == nil || iat.Unix() <= tokensValidAfter.Unix()
+}
+
+// impersonationActor loads the administrator named by the "act" claim and
+// checks they may still impersonate, so revoking the admin's tokens or role
+// also ends their impersonation tokens.
+func impersonationActor(c *gin.Context, act map[string]interface{}, claims jwt.MapClaims) (models.User, bool) {
+	var actor models.User
+	if err := config.DB.WithContext(c.Request.Context()).First(&actor, act["sub"]).Error; err != nil {
+		return actor, false
+	}
+	if issuedBeforeRevocation(claims, actor.TokensValidAfter) {
+		return actor, false
+	}
+	perms, err := utils.RolePermissions(c.Request.Context(), actor.Role)
+	return actor, err == nil && utils.HasPermission(perms, models.PermUsersImpersonate)
+}
+
+// requireAPIKey authenticates a machine client by API key. The key acts as
+// its owner, limited to the scopes it was created with.
+func requireAPIKey(c *gin.Context, rawKey string) {
+	ctx := c.Request.Context()
+	prefix, ok := utils.APIKeyPrefix(rawKey)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return
+	}
+
+	var key models.APIKey
+	if err := config.DB.WithContext(ctx).Where("prefix = ?", prefix).First(&key).Error; err != nil ||
+		subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(utils.HashToken(rawKey))) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return
+	}
+	if !key.Active() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key has been revoked or has expired"})
+		return
 	}
+
+	var user models.User
+	if err := config.DB.WithContext(ctx).First(&user, key.UserID).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User associated with API key not found"})
+		return
+	}
+
+	// บันทึกเวลาที่ใช้งานล่าสุด ไม่เกินนาทีละครั้งเพื่อลดการเขียนฐานข้อมูล
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > time.Minute {
+		go config.DB.Model(&models.APIKey{}).Where("id = ?", key.ID).Update("last_used_at", time.Now())
+	}
+
+	c.Set("user", user)
+	c.Set("api_key", key)
+	c.Set("api_key_scopes", key.ScopeList())
+	c.Set("auth_method", "api_key")
+	c.Next()
 }
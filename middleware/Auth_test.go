@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestIssuedBeforeRevocation(t *testing.T) {
+	// parsed tokens carry numbers as float64
+	iat := func(t time.Time) float64 { return float64(t.Unix()) }
+	revokedAt := time.Date(2026, 1, 2, 10, 0, 0, 500*int(time.Millisecond), time.UTC)
+	tests := []struct {
+		name             string
+		claims           jwt.MapClaims
+		tokensValidAfter *time.Time
+		want             bool
+	}{
+		{"never revoked", jwt.MapClaims{"iat": iat(revokedAt.Add(-time.Hour))}, nil, false},
+		{"issued earlier", jwt.MapClaims{"iat": iat(revokedAt.Add(-time.Minute))}, &revokedAt, true},
+		{"issued in the same second", jwt.MapClaims{"iat": iat(revokedAt)}, &revokedAt, true},
+		{"issued later", jwt.MapClaims{"iat": iat(revokedAt.Add(time.Second))}, &revokedAt, false},
+		{"without iat", jwt.MapClaims{}, &revokedAt, true},
+		{"malformed iat", jwt.MapClaims{"iat": "yesterday"}, &revokedAt, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := issuedBeforeRevocation(tt.claims, tt.tokensValidAfter); got != tt.want {
+				t.Fatalf("issuedBeforeRevocation = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditImpersonation writes every request made with an impersonation token to
+// the audit log and, when config.ImpersonationReadOnly is on, refuses
+// anything but safe methods. It must run after RequireAuth.
+func AuditImpersonation(c *gin.Context) {
+	value, ok := c.Get("actor")
+	if !ok {
+		c.Next()
+		return
+	}
+	actor := value.(models.User)
+	user := c.MustGet("user").(models.User)
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+	default:
+		if config.ImpersonationReadOnly() {
+			utils.AbortWithProblem(c, http.StatusForbidden, "Impersonation sessions are read-only.", gin.H{"reason": "impersonation_read_only"})
+		} else {
+			c.Next()
+		}
+	}
+
+	entry := models.AuditLog{
+		ActorID:   actor.Id,
+		UserID:    user.Id,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Status:    c.Writer.Status(),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if err := config.DB.WithContext(c.Request.Context()).Create(&entry).Error; err != nil {
+		log.Printf("ERROR: Failed to write audit log for admin %d acting as user %d: %v", actor.Id, user.Id, err)
+	}
+}
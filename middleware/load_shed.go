@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"API/config"
+	"API/utils"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request priorities. When the limiter is busy, waiting requests of a higher
+// priority are let in first.
+const (
+	PriorityLow    = iota // anonymous reads
+	PriorityNormal        // authenticated reads and anonymous writes
+	PriorityHigh          // authenticated writes
+)
+
+// priorityShare is how much of the limit each priority may fill, so lower
+// priorities always leave room for higher ones.
+var priorityShare = [...]float64{PriorityLow: 0.7, PriorityNormal: 0.9, PriorityHigh: 1}
+
+// shedRetryAfter is the Retry-After sent with a 503 from ConcurrencyLimit.
+const shedRetryAfter = time.Second
+
+// ConcurrencyLimit caps the requests handled at once by the routes it is
+// attached to, with the named config.ConcurrencyLimit. Requests over the
+// limit wait briefly in a priority queue and are otherwise shed with 503.
+// The limit is lowered when responses are slower than the target latency
+// and raised again while they are fast.
+func ConcurrencyLimit(name string) gin.HandlerFunc {
+	cfg := config.ConcurrencyLimit(name)
+	if cfg.Max == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	limiter := newConcurrencyLimiter(cfg)
+	return func(c *gin.Context) {
+		if !limiter.acquire(c.Request.Context(), requestPriority(c)) {
+			c.Header("Retry-After", headerSeconds(shedRetryAfter))
+			utils.AbortWithProblem(c, http.StatusServiceUnavailable, "Server is busy, please retry later", nil)
+			return
+		}
+		start := time.Now()
+		defer func() { limiter.release(time.Since(start)) }()
+		c.Next()
+	}
+}
+
+// requestPriority ranks the request. Only a user verified by RequireAuth
+// counts as authenticated; unchecked credentials could be forged to jump the
+// queue, so the global limiter, which runs first, ranks everyone as anonymous.
+func requestPriority(c *gin.Context) int {
+	_, authenticated := c.Get("user")
+	write := c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead && c.Request.Method != http.MethodOptions
+	switch {
+	case authenticated && write:
+		return PriorityHigh
+	case authenticated || write:
+		return PriorityNormal
+	default:
+		return PriorityLow
+	}
+}
+
+type concurrencyLimiter struct {
+	cfg config.ConcurrencyLimitConfig
+
+	mu           sync.Mutex
+	limit        float64
+	inFlight     int
+	waiting      [len(priorityShare)][]*concurrencyWaiter // FIFO per priority
+	queued       int
+	lastDecrease time.Time
+}
+
+type concurrencyWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+func newConcurrencyLimiter(cfg config.ConcurrencyLimitConfig) *concurrencyLimiter {
+	return &concurrencyLimiter{cfg: cfg, limit: float64(cfg.Max)}
+}
+
+// capacity is how many requests may be in flight before a request of
+// priority p has to wait.
+func (l *concurrencyLimiter) capacity(p int) int {
+	return max(1, int(l.limit*priorityShare[p]))
+}
+
+// waitersAtOrAbove reports whether requests of priority p or higher are
+// queued, so a new request does not overtake them.
+func (l *concurrencyLimiter) waitersAtOrAbove(p int) bool {
+	for i := p; i < len(l.waiting); i++ {
+		if len(l.waiting[i]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// acquire takes a slot, waiting up to QueueTimeout for one. It returns false
+// when the request should be shed.
+func (l *concurrencyLimiter) acquire(ctx context.Context, p int) bool {
+	l.mu.Lock()
+	if l.inFlight < l.capacity(p) && !l.waitersAtOrAbove(p) {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+	if l.queued >= l.cfg.QueueSize || l.cfg.QueueTimeout == 0 {
+		l.mu.Unlock()
+		return false
+	}
+	w := &concurrencyWaiter{ready: make(chan struct{})}
+	l.waiting[p] = append(l.waiting[p], w)
+	l.queued++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.cfg.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.granted {
+		// ได้ slot มาพร้อมกับที่หมดเวลาพอดี
+		return true
+	}
+	for i, queued := range l.waiting[p] {
+		if queued == w {
+			l.waiting[p] = append(l.waiting[p][:i], l.waiting[p][i+1:]...)
+			l.queued--
+			break
+		}
+	}
+	return false
+}
+
+// release frees the slot of a request that took latency to handle, adapts the
+// limit and lets queued requests in.
+func (l *concurrencyLimiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+
+	now := time.Now()
+	if l.cfg.TargetLatency > 0 && latency > l.cfg.TargetLatency {
+		// ลดได้ครั้งเดียวต่อช่วง TargetLatency เพื่อไม่ให้คำขอช้าที่เสร็จพร้อมกันลด limit ซ้ำหลายรอบ
+		if now.Sub(l.lastDecrease) >= l.cfg.TargetLatency {
+			l.limit = max(float64(l.cfg.Min), l.limit*0.9)
+			l.lastDecrease = now
+		}
+	} else {
+		// เพิ่มทีละน้อย ประมาณ 1 ต่อ limit คำขอที่เร็ว
+		l.limit = min(float64(l.cfg.Max), l.limit+1/l.limit)
+	}
+
+	for p := len(l.waiting) - 1; p >= 0; p-- {
+		for len(l.waiting[p]) > 0 && l.inFlight < l.capacity(p) {
+			w := l.waiting[p][0]
+			l.waiting[p] = l.waiting[p][1:]
+			l.queued--
+			l.inFlight++
+			w.granted = true
+			close(w.ready)
+		}
+		if len(l.waiting[p]) > 0 {
+			// ยังมีคำขอที่สำคัญกว่ารออยู่ ไม่ให้ priority ที่ต่ำกว่าแซง
+			break
+		}
+	}
+}
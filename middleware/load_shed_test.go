@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"API/config"
+	"API/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConcurrencyLimiterPriorityShares(t *testing.T) {
+	// no queue, so a request that has to wait is shed straight away
+	l := newConcurrencyLimiter(config.ConcurrencyLimitConfig{Max: 10, Min: 1})
+	ctx := context.Background()
+	tests := []struct {
+		priority int
+		admitted int // how many requests of this priority get in, on top of the earlier rows
+	}{
+		{PriorityLow, 7},
+		{PriorityNormal, 2},
+		{PriorityHigh, 1},
+	}
+	for _, tt := range tests {
+		for i := 0; i < tt.admitted; i++ {
+			if !l.acquire(ctx, tt.priority) {
+				t.Fatalf("priority %d: request %d was shed at %d in flight", tt.priority, i+1, l.inFlight)
+			}
+		}
+		if l.acquire(ctx, tt.priority) {
+			t.Fatalf("priority %d: admitted beyond its share at %d in flight", tt.priority, l.inFlight)
+		}
+	}
+}
+
+func TestConcurrencyLimiterQueue(t *testing.T) {
+	l := newConcurrencyLimiter(config.ConcurrencyLimitConfig{Max: 1, Min: 1, QueueSize: 2, QueueTimeout: time.Second})
+	ctx := context.Background()
+	if !l.acquire(ctx, PriorityHigh) {
+		t.Fatal("first request was shed")
+	}
+
+	order := make(chan int, 2)
+	wait := func(p int) {
+		if l.acquire(ctx, p) {
+			order <- p
+		}
+	}
+	go wait(PriorityLow)
+	waitForQueued(t, l, 1)
+	go wait(PriorityHigh)
+	waitForQueued(t, l, 2)
+	if l.acquire(ctx, PriorityNormal) {
+		t.Fatal("request admitted with a full queue")
+	}
+
+	// the high priority request overtakes the low one that queued first
+	l.release(0)
+	if p := <-order; p != PriorityHigh {
+		t.Fatalf("first admitted priority %d, want %d", p, PriorityHigh)
+	}
+	l.release(0)
+	if p := <-order; p != PriorityLow {
+		t.Fatalf("second admitted priority %d, want %d", p, PriorityLow)
+	}
+}
+
+func TestConcurrencyLimiterGivesUpWaiting(t *testing.T) {
+	timeout := config.ConcurrencyLimitConfig{Max: 1, Min: 1, QueueSize: 1, QueueTimeout: 20 * time.Millisecond}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"queue timeout", context.Background()},
+		{"client gone", canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newConcurrencyLimiter(timeout)
+			l.acquire(context.Background(), PriorityHigh)
+			if l.acquire(tt.ctx, PriorityHigh) {
+				t.Fatal("request admitted while the slot was taken")
+			}
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.queued != 0 || len(l.waiting[PriorityHigh]) != 0 {
+				t.Fatalf("queue not cleaned up: queued=%d", l.queued)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiterAdaptsLimit(t *testing.T) {
+	l := newConcurrencyLimiter(config.ConcurrencyLimitConfig{Max: 100, Min: 80, TargetLatency: time.Hour})
+	ctx := context.Background()
+
+	l.acquire(ctx, PriorityHigh)
+	l.release(2 * time.Hour)
+	if l.limit != 90 {
+		t.Fatalf("limit after a slow response = %v, want 90", l.limit)
+	}
+	// further slow responses within TargetLatency do not lower it again
+	l.acquire(ctx, PriorityHigh)
+	l.release(2 * time.Hour)
+	if l.limit != 90 {
+		t.Fatalf("limit after a second slow response = %v, want 90", l.limit)
+	}
+	// nor below Min
+	l.lastDecrease = time.Time{}
+	l.limit = 85
+	l.acquire(ctx, PriorityHigh)
+	l.release(2 * time.Hour)
+	if l.limit != 80 {
+		t.Fatalf("limit = %v, want Min 80", l.limit)
+	}
+
+	for i := 0; i < 10000; i++ {
+		l.acquire(ctx, PriorityHigh)
+		l.release(time.Millisecond)
+	}
+	if l.limit != 100 {
+		t.Fatalf("limit after fast responses = %v, want Max 100", l.limit)
+	}
+}
+
+func TestRequestPriority(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		method   string
+		header   string
+		verified bool
+		want     int
+	}{
+		{"anonymous read", http.MethodGet, "", false, PriorityLow},
+		{"anonymous write", http.MethodPost, "", false, PriorityNormal},
+		{"unverified credentials", http.MethodPost, "Bearer forged", false, PriorityNormal},
+		{"unverified read", http.MethodGet, "Bearer forged", false, PriorityLow},
+		{"authenticated read", http.MethodGet, "Bearer token", true, PriorityNormal},
+		{"authenticated write", http.MethodDelete, "Bearer token", true, PriorityHigh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(tt.method, "/", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("Authorization", tt.header)
+			}
+			if tt.verified {
+				c.Set("user", models.User{Id: 1})
+			}
+			if got := requestPriority(c); got != tt.want {
+				t.Fatalf("priority = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// waitForQueued waits until n requests are queued in l.
+func waitForQueued(t *testing.T, l *concurrencyLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		queued := l.queued
+		l.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d requests never queued", n)
+}
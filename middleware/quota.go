@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"API/config"
+	"API/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Quota counts every request of the authenticated user, and of the API key it
+// was made with, against the daily and monthly quotas and rejects requests
+// once a quota of either is used up; rejected requests are not counted. It must run
+// after RequireAuth and does nothing while no quota is configured.
+func Quota() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if daily, monthly := config.APIQuotas(); daily == 0 && monthly == 0 {
+			c.Next()
+			return
+		}
+		subjects := utils.QuotaSubjectsFromContext(c)
+		if len(subjects) == 0 {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		usage, allowed, err := utils.CountQuotaRequest(c.Request.Context(), subjects, now)
+		if err != nil {
+			// นับ quota ไม่ได้ก็ปล่อยผ่านไปก่อน ส่วน rate limit ยังทำงานอยู่
+			log.Printf("ERROR: Failed to count quota for %v: %v", subjects, err)
+			c.Next()
+			return
+		}
+		if !allowed {
+			for _, period := range usage {
+				if period.UsedUp() {
+					c.Header("Retry-After", headerSeconds(period.ResetAt.Sub(now)))
+					utils.AbortWithProblem(c, http.StatusTooManyRequests, "Quota exceeded", gin.H{
+						"subject":  period.Subject.String(),
+						"period":   period.Period,
+						"limit":    period.Limit,
+						"reset_at": period.ResetAt,
+					})
+					return
+				}
+			}
+			utils.AbortWithProblem(c, http.StatusTooManyRequests, "Quota exceeded", nil)
+			return
+		}
+
+		c.Next()
+	}
+}
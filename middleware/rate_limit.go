@@ -2,50 +2,99 @@ package middleware
 
 import (
 	"API/config"
+	"API/models"
+	"API/utils"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-const (
-	rateLimitPeriod = 1 * time.Minute
-	rateLimitCount  = 5 // อนุญาต 5 ครั้งต่อนาที
-)
+// RateLimit applies the named policy from config.RateLimitPolicies. An
+// unknown name is a programming error and stops the server at startup.
+func RateLimit(name string) gin.HandlerFunc {
+	policy, ok := config.RateLimitPolicyByName(name)
+	if !ok {
+		log.Fatalf("FATAL: Unknown rate limit policy %q", name)
+	}
+	return RateLimitWithPolicy(policy)
+}
 
-func RateLimiter() gin.HandlerFunc {
+// RateLimitWithPolicy limits requests with the given policy. Policies keyed by
+// user or API key must run after RequireAuth.
+func RateLimitWithPolicy(policy config.RateLimitPolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if config.RedisClient == nil {
-			c.Next()
+		result, err := utils.AllowRequest(c.Request.Context(), policy, rateLimitKey(c, policy))
+		if err != nil {
+			// Redis ใช้งานไม่ได้และ policy นี้ตั้งไว้ให้ fail closed
+			utils.AbortWithProblem(c, http.StatusServiceUnavailable, "Service temporarily unavailable", nil)
 			return
 		}
 
-		// ใช้ IP Address เป็น key
-		ip := c.ClientIP()
-		key := "rate_limit:" + ip
-
-		// ใช้ Pipeline เพื่อให้การทำงานของ INCR และ EXPIRE เกิดขึ้นพร้อมกัน (Atomic)
-		var count int64
-		pipe := config.RedisClient.Pipeline()
-		incr := pipe.Incr(c.Request.Context(), key)
-		// ตั้งค่า Expire ทุกครั้งที่เรียก เพื่อความแน่นอนและป้องกัน Race Condition
-		pipe.Expire(c.Request.Context(), key, rateLimitPeriod)
-		_, err := pipe.Exec(c.Request.Context())
-
-		if err != nil {
-			// ถ้า Redis มีปัญหา ก็ปล่อยผ่านไปก่อน แต่ควร log error ไว้
-			c.Next()
+		setRateLimitHeaders(c, result)
+		if !result.Allowed {
+			c.Header("Retry-After", headerSeconds(result.RetryAfter))
+			utils.AbortWithProblem(c, http.StatusTooManyRequests, "Too many requests", gin.H{"policy": policy.Name})
 			return
 		}
 
-		count = incr.Val()
+		c.Next()
+	}
+}
 
-		if count > rateLimitCount {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
-			c.Abort()
+// setRateLimitHeaders sets the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers of the IETF draft. When several policies apply to a
+// route, the one with the fewest remaining requests is reported.
+func setRateLimitHeaders(c *gin.Context, result utils.RateLimitResult) {
+	header := c.Writer.Header()
+	if current := header.Get("RateLimit-Remaining"); current != "" {
+		if remaining, err := strconv.ParseInt(current, 10, 64); err == nil && remaining <= result.Remaining {
 			return
 		}
+	}
+	header.Set("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+	header.Set("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+	header.Set("RateLimit-Reset", headerSeconds(result.ResetAfter))
+}
 
-		c.Next()
+// headerSeconds formats d as whole seconds, rounded up.
+func headerSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// rateLimitKey builds the counter key from the parts the policy is keyed by,
+// e.g. "rate_limit:login:ip:1.2.3.4".
+func rateLimitKey(c *gin.Context, policy config.RateLimitPolicy) string {
+	parts := []string{"rate_limit", policy.Name}
+	for _, part := range policy.Key {
+		switch part {
+		case config.RateLimitKeyAPIKey:
+			if key, ok := c.Get("api_key"); ok {
+				parts = append(parts, fmt.Sprintf("api_key:%d", key.(models.APIKey).ID))
+				continue
+			}
+			fallthrough
+		case config.RateLimitKeyUser:
+			if user, ok := c.Get("user"); ok {
+				parts = append(parts, fmt.Sprintf("user:%d", user.(models.User).Id))
+				continue
+			}
+			fallthrough
+		case config.RateLimitKeyIP:
+			// ใช้ IP Address เป็น key
+			parts = append(parts, "ip:"+c.ClientIP())
+		case config.RateLimitKeyRoute:
+			route := c.FullPath()
+			if route == "" {
+				route = c.Request.URL.Path
+			}
+			parts = append(parts, "route:"+c.Request.Method+" "+route)
+		}
 	}
+	return strings.Join(parts, ":")
 }
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"API/config"
+	"API/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		key    []string
+		user   bool
+		apiKey bool
+		want   string
+	}{
+		{"ip", []string{config.RateLimitKeyIP}, true, true, "rate_limit:test:ip:192.0.2.1"},
+		{"user", []string{config.RateLimitKeyUser}, true, false, "rate_limit:test:user:7"},
+		{"user falls back to the ip", []string{config.RateLimitKeyUser}, false, false, "rate_limit:test:ip:192.0.2.1"},
+		{"api key", []string{config.RateLimitKeyAPIKey}, true, true, "rate_limit:test:api_key:3"},
+		{"api key falls back to the user", []string{config.RateLimitKeyAPIKey}, true, false, "rate_limit:test:user:7"},
+		{"api key falls back to the ip", []string{config.RateLimitKeyAPIKey}, false, false, "rate_limit:test:ip:192.0.2.1"},
+		{"user and route", []string{config.RateLimitKeyUser, config.RateLimitKeyRoute}, true, false, "rate_limit:test:user:7:route:GET /products/:id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			router := gin.New()
+			router.GET("/products/:id", func(c *gin.Context) {
+				if tt.user {
+					c.Set("user", models.User{Id: 7})
+				}
+				if tt.apiKey {
+					c.Set("api_key", models.APIKey{ID: 3})
+				}
+				got = rateLimitKey(c, config.RateLimitPolicy{Name: "test", Key: tt.key})
+			})
+			req := httptest.NewRequest(http.MethodGet, "/products/1", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			router.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Fatalf("key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitWithPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// no Redis in tests, so the policy counts in memory
+	policy := config.RateLimitPolicy{
+		Name:      "test_" + strconv.FormatInt(time.Now().UnixNano(), 10),
+		Algorithm: config.RateLimitSlidingWindow,
+		Limit:     2,
+		Period:    time.Minute,
+		Key:       []string{config.RateLimitKeyIP},
+		OnFailure: config.RateLimitFailLocal,
+	}
+	router := gin.New()
+	router.GET("/", RateLimitWithPolicy(policy), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for i, want := range []struct {
+		status    int
+		remaining string
+	}{{http.StatusNoContent, "1"}, {http.StatusNoContent, "0"}, {http.StatusTooManyRequests, "0"}} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != want.status {
+			t.Fatalf("request %d: status %d, want %d", i+1, rec.Code, want.status)
+		}
+		if got := rec.Header().Get("RateLimit-Remaining"); got != want.remaining {
+			t.Errorf("request %d: RateLimit-Remaining = %q, want %q", i+1, got, want.remaining)
+		}
+		if rec.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("request %d: RateLimit-Limit = %q, want 2", i+1, rec.Header().Get("RateLimit-Limit"))
+		}
+		if want.status != http.StatusTooManyRequests {
+			continue
+		}
+		if rec.Header().Get("Retry-After") == "" {
+			t.Error("429 without Retry-After")
+		}
+		var problem map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil || problem["policy"] != policy.Name || problem["status"] != float64(http.StatusTooManyRequests) {
+			t.Errorf("429 body = %s, want a problem naming the policy", rec.Body)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"API/models"
+	"API/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission only lets the request through when the role of the user
+// set by RequireAuth grants every listed permission.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted, ok := loadPermissions(c)
+		if !ok {
+			return
+		}
+		scopes, scoped := c.Get("api_key_scopes")
+		for _, p := range permissions {
+			if !utils.HasPermission(granted, p) {
+				abortForbidden(c, fmt.Sprintf("Missing permission '%s'.", p), gin.H{"missing_permission": p})
+				return
+			}
+			if scoped && !utils.HasPermission(scopes.([]string), p) {
+				abortForbidden(c, fmt.Sprintf("API key is missing scope '%s'.", p), gin.H{"missing_permission": p})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireRole only lets the request through when the user has one of the given roles.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		role := user.Role
+		if role == "" {
+			role = models.RoleUser
+		}
+		for _, r := range roles {
+			if r == role {
+				c.Next()
+				return
+			}
+		}
+		abortForbidden(c, fmt.Sprintf("One of the roles %v is required.", roles), gin.H{"required_roles": roles})
+	}
+}
+
+// RejectAPIKey blocks requests made with an API key. Account management
+// (profile, password, MFA, sessions, exports, erasure, API keys) needs the
+// user's own login, since scopes only limit the routes behind
+// RequirePermission and a leaked key must not be able to take over the
+// account.
+func RejectAPIKey(c *gin.Context) {
+	if _, ok := c.Get("api_key"); ok {
+		abortForbidden(c, "This endpoint cannot be used with an API key.", gin.H{"reason": "api_key_not_allowed"})
+		return
+	}
+	c.Next()
+}
+
+// loadPermissions resolves (once per request) the permissions of the current user.
+func loadPermissions(c *gin.Context) ([]string, bool) {
+	if perms, exists := c.Get("permissions"); exists {
+		return perms.([]string), true
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return nil, false
+	}
+	perms, err := utils.RolePermissions(c.Request.Context(), user.Role)
+	if err != nil {
+		abortForbidden(c, fmt.Sprintf("Role '%s' does not exist.", user.Role), nil)
+		return nil, false
+	}
+	c.Set("permissions", perms)
+	return perms, true
+}
+
+func currentUser(c *gin.Context) (models.User, bool) {
+	value, exists := c.Get("user")
+	if !exists {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return models.User{}, false
+	}
+	return value.(models.User), true
+}
+
+func abortForbidden(c *gin.Context, detail string, extra gin.H) {
+	utils.AbortWithProblem(c, http.StatusForbidden, detail, extra)
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"API/config"
+	"API/models"
+	"API/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TenantHeader selects the organization for a request. Without it the "org"
+// claim of the access token is used, then the user's first membership.
+const TenantHeader = "X-Organization-ID"
+
+// ResolveTenant picks the organization of the request and puts it on the
+// request context, which scopes every GORM query made with that context (see
+// config.WithTenant). It also adds the membership role's permissions to the
+// user's global ones. It must run after RequireAuth.
+//
+// Users whose global role grants "*" may select any organization, and are
+// not scoped at all when they select none. Everyone else without a
+// membership is scoped to no organization and sees no tenant data.
+func ResolveTenant(c *gin.Context) {
+	ctx := c.Request.Context()
+	user := c.MustGet("user").(models.User)
+	granted, err := utils.RolePermissions(ctx, user.Role)
+	if err != nil {
+		abortForbidden(c, "Role '"+user.Role+"' does not exist.", nil)
+		return
+	}
+	platformAdmin := utils.HasPermission(granted, models.PermAll)
+
+	var membership models.Membership
+	found := false
+	if header := c.GetHeader(TenantHeader); header != "" {
+		orgID, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid " + TenantHeader + " header"})
+			return
+		}
+		found = findMembership(c, user.Id, "organization_id = ?", orgID, &membership)
+		if !found {
+			if !platformAdmin || !organizationExists(c, uint(orgID)) {
+				abortForbidden(c, "You are not a member of this organization.", gin.H{"organization_id": orgID})
+				return
+			}
+			membership.OrganizationID = uint(orgID)
+		}
+	} else {
+		if claims, ok := c.Get("claims"); ok {
+			if org, ok := claims.(jwt.MapClaims)["org"].(float64); ok && org > 0 {
+				found = findMembership(c, user.Id, "organization_id = ?", uint(org), &membership)
+			}
+		}
+		if !found {
+			found = findMembership(c, user.Id, "", nil, &membership)
+		}
+	}
+
+	if found && membership.Role != "" {
+		orgPerms, err := utils.RolePermissions(ctx, membership.Role)
+		if err == nil {
+			granted = append(append([]string{}, granted...), tenantPermissions(orgPerms)...)
+		}
+		c.Set("membership", membership)
+	}
+	c.Set("permissions", granted)
+
+	if membership.OrganizationID != 0 || !platformAdmin {
+		c.Set("organization_id", membership.OrganizationID)
+		c.Request = c.Request.WithContext(config.WithTenant(ctx, membership.OrganizationID))
+	}
+	c.Next()
+}
+
+// tenantPermissions drops the permissions of a membership role that would reach
+// beyond the organization, including wildcards such as "users:*" that cover a
+// platform permission.
+func tenantPermissions(perms []string) []string {
+	allowed := make([]string, 0, len(perms))
+	for _, p := range perms {
+		platform := false
+		for _, pp := range models.PlatformPermissions {
+			if utils.HasPermission([]string{p}, pp) {
+				platform = true
+				break
+			}
+		}
+		if !platform {
+			allowed = append(allowed, p)
+		}
+	}
+	return allowed
+}
+
+func findMembership(c *gin.Context, userID uint, where string, arg interface{}, membership *models.Membership) bool {
+	db := config.DB.WithContext(c.Request.Context()).Where("user_id = ?", userID)
+	if where != "" {
+		db = db.Where(where, arg)
+	}
+	return db.Order("id").First(membership).Error == nil
+}
+
+func organizationExists(c *gin.Context, id uint) bool {
+	var count int64
+	config.DB.WithContext(c.Request.Context()).Model(&models.Organization{}).Where("id = ?", id).Count(&count)
+	return count > 0
+}
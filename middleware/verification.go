@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"API/config"
+	"API/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVerifiedEmail blocks users whose email address is not verified yet,
+// unless EMAIL_VERIFICATION_POLICY is "off".
+func RequireVerifiedEmail(c *gin.Context) {
+	if config.EmailVerificationPolicy() == config.EmailVerificationOff {
+		c.Next()
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.EmailVerified() {
+		utils.AbortWithProblem(c, http.StatusForbidden, "Verify your email address before using this endpoint.", gin.H{"reason": "email_not_verified"})
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey lets a machine client authenticate as its owner with the
+// "Authorization: ApiKey <key>" scheme. The key is only shown once at
+// creation; Prefix identifies it and KeyHash (SHA-256) verifies it.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:16;uniqueIndex;not null" json:"prefix"`
+	KeyHash    string     `gorm:"size:64;not null" json:"-"`
+	Scopes     string     `json:"-"` // space separated permission names
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// Active reports whether the key is neither revoked nor expired.
+func (k APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// APIUsage counts the requests of a user, or of one of their API keys, in a
+// daily or monthly quota period. It is only used when Redis is unavailable;
+// otherwise the counters live in Redis.
+type APIUsage struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"uniqueIndex:idx_api_usage_subject_period;index;not null" json:"user_id"`
+	APIKeyID    uint      `gorm:"uniqueIndex:idx_api_usage_subject_period;not null" json:"api_key_id"` // 0 for requests made with a token
+	Period      string    `gorm:"uniqueIndex:idx_api_usage_subject_period;size:10;not null" json:"period"`
+	PeriodStart time.Time `gorm:"uniqueIndex:idx_api_usage_subject_period;not null" json:"period_start"`
+	Count       int64     `gorm:"not null" json:"count"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// AuditLog records a request made by ActorID while impersonating UserID.
+// OrganizationID is the tenant the request ran in, so audit logs are scoped
+// like every other tenant table.
+type AuditLog struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID uint      `gorm:"index" json:"organization_id"`
+	ActorID        uint      `gorm:"index;not null" json:"actor_id"`
+	UserID         uint      `gorm:"index;not null" json:"user_id"`
+	Method         string    `gorm:"size:10;not null" json:"method"`
+	Path           string    `gorm:"not null" json:"path"`
+	Status         int       `json:"status"`
+	IP             string    `gorm:"size:64" json:"ip"`
+	UserAgent      string    `json:"user_agent"`
+	CreatedAt      time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Data export job states.
+const (
+	DataExportPending   = "pending"
+	DataExportRunning   = "running"
+	DataExportCompleted = "completed"
+	DataExportFailed    = "failed"
+)
+
+// DataExport is a user's request for a copy of their data. The archive is
+// written to FilePath and can be downloaded until ExpiresAt.
+type DataExport struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"index;not null" json:"user_id"`
+	Status      string     `gorm:"size:20;not null" json:"status"`
+	FilePath    string     `json:"-"`
+	Error       string     `json:"error,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ExternalIdentity links an account at an OpenID Connect provider to a User.
+type ExternalIdentity struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"index;not null" json:"user_id"`
+	Provider    string     `gorm:"size:50;uniqueIndex:idx_provider_subject;not null" json:"provider"`
+	Subject     string     `gorm:"size:255;uniqueIndex:idx_provider_subject;not null" json:"subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
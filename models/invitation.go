@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Invitation lets the owner of Email register while registration is
+// invite-only. Invitations made inside an organization make the new user a
+// member with Role; the others set the global role. Only the hash of the
+// token is stored.
+type Invitation struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	OrganizationID uint       `gorm:"index" json:"organization_id"`
+	Email          string     `gorm:"index;not null" json:"email"`
+	Role           string     `gorm:"not null" json:"role"`
+	TokenHash      string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	InvitedBy      uint       `json:"invited_by"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+	AcceptedBy     *uint      `json:"accepted_by"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// MagicLinkToken is a single-use sign-in link sent by /login/magic. Only the
+// hash of the token is stored.
+type MagicLinkToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
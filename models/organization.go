@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Organization is a tenant. Products and memberships belong to exactly one
+// organization and are only visible inside it.
+type Organization struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	Slug      string    `gorm:"size:100;uniqueIndex;not null" json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Membership gives a user a role inside one organization. The role's
+// permissions add to those of the user's global role while that
+// organization is the current tenant.
+type Membership struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID uint      `gorm:"uniqueIndex:idx_membership_org_user;not null" json:"organization_id"`
+	UserID         uint      `gorm:"uniqueIndex:idx_membership_org_user;index;not null" json:"user_id"`
+	Role           string    `gorm:"not null" json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RecoveryCode is a one-time code that replaces a TOTP code when the user
+// has lost their authenticator. Only the SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
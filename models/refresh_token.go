@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// RefreshToken stores the hashed form of a refresh token issued by /login or
+// /token/refresh. Every token created by rotating another one shares the same
+// FamilyID, which lets us revoke the whole chain when a used token is replayed.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	FamilyID  string     `gorm:"size:64;index;not null" json:"family_id"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`    // set when the token is rotated
+	RevokedAt *time.Time `json:"revoked_at"` // set when the family is revoked
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RevokedToken is the database copy of the access token denylist. Rows can be
+// removed once ExpiresAt has passed because the token is rejected anyway.
+type RevokedToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	JTI       string    `gorm:"size:64;uniqueIndex;not null" json:"jti"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Permission names used by middleware.RequirePermission. A role may also hold
+// "*" (everything) or "<resource>:*" (every action on one resource).
+const (
+	PermUsersRead        = "users:read"
+	PermUsersAdmin       = "users:admin"
+	PermProductsRead     = "products:read"
+	PermProductsWrite    = "products:write"
+	PermRolesAdmin       = "roles:admin"
+	PermKeysAdmin        = "keys:admin"
+	PermUsersImpersonate = "users:impersonate"
+	PermOrgsAdmin        = "organizations:admin"
+	PermMembersAdmin     = "members:admin"
+	PermAll              = "*"
+)
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+	// Default roles for organization memberships.
+	RoleOrgAdmin  = "org_admin"
+	RoleOrgMember = "org_member"
+)
+
+// PlatformPermissions reach beyond a single organization, so only holders of
+// roles:admin may hand out roles that grant them, and membership roles never
+// grant them. users:admin is one of them because it manages the global
+// account; organization admins manage members with members:admin.
+var PlatformPermissions = []string{PermAll, PermUsersAdmin, PermRolesAdmin, PermKeysAdmin, PermUsersImpersonate, PermOrgsAdmin}
+
+type Permission struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `gorm:"size:100;uniqueIndex;not null" json:"name"`
+	Description string `json:"description"`
+}
+
+// Role is referenced by name from User.Role.
+type Role struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	Name        string       `gorm:"size:50;uniqueIndex;not null" json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions;" json:"permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Security event types.
+const (
+	SecurityEventAccountLocked    = "account_locked"
+	SecurityEventAccountUnlocked  = "account_unlocked"
+	SecurityEventImpersonated     = "impersonated"
+	SecurityEventErasureRequested = "erasure_requested"
+	SecurityEventErasureCancelled = "erasure_cancelled"
+)
+
+// SecurityEvent is an append-only record of security relevant activity on an account.
+type SecurityEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	Type      string    `gorm:"size:50;index;not null" json:"type"`
+	IP        string    `gorm:"size:64" json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
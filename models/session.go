@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Session is created by every successful login. Its ID is also the family
+// ID of the refresh tokens issued for it and the "sid" claim of its access
+// tokens, so revoking a session cuts off both.
+type Session struct {
+	ID         string     `gorm:"primaryKey;size:64" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `gorm:"size:64" json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -12,4 +14,29 @@ type User struct {
 	Email        string     `json:"email" gorm:"unique"`
 	Role         string     `json:"role"`
 	PasswordHash string     `json:"-"` // ซ่อน PasswordHash จาก JSON output
+	// Access tokens issued before this moment are rejected by RequireAuth.
+	TokensValidAfter *time.Time `json:"-"`
+	// TOTP two-factor authentication. The secret is set on enrolment and
+	// TOTPEnabled only becomes true once the user confirmed a code.
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `json:"totp_enabled"`
+	TOTPLastStep int64  `json:"-"` // last accepted time step, blocks code replay
+	// Nil until the user follows the link sent by /register.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// SHA-256 of the outstanding password reset token. Requesting a new one
+	// or changing the password clears it, so only the newest link works once.
+	PasswordResetToken   string     `gorm:"size:64;index" json:"-"`
+	PasswordResetExpires *time.Time `json:"-"`
+	// Brute-force protection, maintained by the login guard.
+	FailedLoginCount   int        `json:"-"`
+	LastFailedLoginAt  *time.Time `json:"-"`
+	LockedUntil        *time.Time `json:"locked_until"`
+	UnlockToken        string     `gorm:"size:64;index" json:"-"` // SHA-256 of the emailed unlock token
+	UnlockTokenExpires *time.Time `json:"-"`
+	// Set by an erasure request; the account is erased once this passes.
+	ErasureScheduledAt *time.Time `gorm:"index" json:"erasure_scheduled_at"`
+}
+
+func (u User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
@@ -13,8 +13,8 @@ func UserRoute(router *gin.Engine) {
 	router.POST("/", controller.CreateUser)
 	router.DELETE("/:id", controller.DeleteUser)
 	router.PUT("/:id", controller.UpdateUser)
-	router.POST("/login", middleware.RateLimiter(), controller.Login) // เพิ่มบรรทัดนี้
-	router.POST("/register", middleware.RateLimiter(), controller.CreateUser)
-	router.POST("/forgot-password", middleware.RateLimiter(), controller.ForgotPassword)
-	router.POST("/reset-password", middleware.RateLimiter(), controller.ResetPassword)
+	router.POST("/login", middleware.RateLimit("login"), controller.Login) // เพิ่มบรรทัดนี้
+	router.POST("/register", middleware.RateLimit("register"), controller.CreateUser)
+	router.POST("/forgot-password", middleware.RateLimit("password_reset"), controller.ForgotPassword)
+	router.POST("/reset-password", middleware.RateLimit("password_reset"), controller.ResetPassword)
 }
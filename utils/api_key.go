@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"strings"
+)
+
+const apiKeyPrefix = "gak_"
+
+// GenerateAPIKey returns a new API key of the form gak_<prefix>_<secret>
+// together with its lookup prefix and the hash to store.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	prefix, err = RandomToken(9)
+	if err != nil {
+		return "", "", "", err
+	}
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	// base64url may contain "_", which is our separator.
+	prefix = strings.ReplaceAll(prefix, "_", "-")
+	key = apiKeyPrefix + prefix + "_" + secret
+	return key, prefix, HashToken(key), nil
+}
+
+// APIKeyPrefix extracts the lookup prefix from a presented key.
+func APIKeyPrefix(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	return prefix, ok && prefix != ""
+}
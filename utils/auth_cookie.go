@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cookies used by the cookie auth mode (config.AuthModeCookie). The access
+// and refresh tokens are HttpOnly; the CSRF token is readable by the frontend,
+// which echoes it in the X-CSRF-Token header (double-submit).
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFTokenCookie    = "csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+
+	// The refresh token is only ever sent to /token/refresh.
+	refreshTokenCookiePath = "/token"
+)
+
+// SetAuthCookies stores the tokens in cookies and returns a new CSRF token,
+// which is also set as a cookie. Cookie attributes come from COOKIE_SECURE
+// (default true), COOKIE_SAMESITE (strict, lax or none; default lax) and
+// COOKIE_DOMAIN.
+func SetAuthCookies(c *gin.Context, accessToken, refreshToken string, accessTTL, refreshTTL time.Duration) (string, error) {
+	csrf, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	setCookie(c, AccessTokenCookie, accessToken, "/", accessTTL, true)
+	setCookie(c, RefreshTokenCookie, refreshToken, refreshTokenCookiePath, refreshTTL, true)
+	setCookie(c, CSRFTokenCookie, csrf, "/", refreshTTL, false)
+	return csrf, nil
+}
+
+// ClearAuthCookies removes the auth cookies, e.g. on logout.
+func ClearAuthCookies(c *gin.Context) {
+	setCookie(c, AccessTokenCookie, "", "/", -1, true)
+	setCookie(c, RefreshTokenCookie, "", refreshTokenCookiePath, -1, true)
+	setCookie(c, CSRFTokenCookie, "", "/", -1, false)
+}
+
+// ValidCSRF reports whether the X-CSRF-Token header matches the CSRF cookie.
+// Safe methods never need a CSRF token.
+func ValidCSRF(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	cookie, err := c.Cookie(CSRFTokenCookie)
+	header := c.GetHeader(CSRFHeader)
+	return err == nil && cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+func setCookie(c *gin.Context, name, value, path string, maxAge time.Duration, httpOnly bool) {
+	seconds := int(maxAge.Seconds())
+	if maxAge < 0 {
+		seconds = -1
+	}
+	secure, err := strconv.ParseBool(os.Getenv("COOKIE_SECURE"))
+	if err != nil {
+		secure = true
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   os.Getenv("COOKIE_DOMAIN"),
+		MaxAge:   seconds,
+		Secure:   secure,
+		HttpOnly: httpOnly,
+		SameSite: cookieSameSite(),
+	})
+}
+
+func cookieSameSite() http.SameSite {
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
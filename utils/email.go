@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"gopkg.in/gomail.v2"
 )
@@ -13,16 +14,70 @@ import (
 // It reads configuration from environment variables:
 // SMTP_HOST, SMTP_PORT, SMTP_USER, SMTP_PASS
 func SendPasswordResetEmail(email, token string) error {
+	// Construct the reset link
+	// In a real app, the base URL should come from config
+	resetLink := fmt.Sprintf("http://localhost:3003/reset-password?token=%s", token)
+
+	if !smtpConfigured() {
+		return logSimulatedEmail(email, token)
+	}
+	return sendEmail(email, "Reset Your Password",
+		fmt.Sprintf("To reset your password, please click the following link: <a href=\"%s\">%s</a>", resetLink, resetLink))
+}
+
+// SendVerificationEmail sends the link that confirms the user owns the address.
+// The link points at the API's /verify-email endpoint (API_BASE_URL).
+func SendVerificationEmail(email, token string) error {
+	verifyLink := fmt.Sprintf("%s/verify-email?token=%s", apiBaseURL(), token)
+	return sendEmail(email, "Verify Your Email Address",
+		fmt.Sprintf("To verify your email address, please click the following link: <a href=\"%s\">%s</a>", verifyLink, verifyLink))
+}
+
+// SendUnlockEmail tells the user their account was locked after too many
+// failed logins and sends a link that unlocks it right away.
+func SendUnlockEmail(email, token string, lockedFor string) error {
+	unlockLink := fmt.Sprintf("%s/unlock-account?token=%s", apiBaseURL(), token)
+	return sendEmail(email, "Your Account Has Been Locked",
+		fmt.Sprintf("Your account was locked for %s after too many failed login attempts. If this was you, you can unlock it now: <a href=\"%s\">%s</a>. If it was not you, consider changing your password.", lockedFor, unlockLink, unlockLink))
+}
+
+// SendMagicLinkEmail sends a single-use sign-in link. The link opens the
+// frontend (APP_BASE_URL), which posts the token to /login/magic/verify, so
+// mail scanners following the link cannot use it up.
+func SendMagicLinkEmail(email, token string, validFor string) error {
+	loginLink := fmt.Sprintf("%s/login/magic?token=%s", appBaseURL(), token)
+	return sendEmail(email, "Your Sign-In Link",
+		fmt.Sprintf("Click the following link to sign in. It is valid for %s and can be used once: <a href=\"%s\">%s</a>. If you did not ask to sign in, you can ignore this email.", validFor, loginLink, loginLink))
+}
+
+// SendInvitationEmail sends the link that lets someone register while
+// registration is invite-only. It opens the frontend's sign-up page.
+func SendInvitationEmail(email, token string, expires time.Time) error {
+	inviteLink := fmt.Sprintf("%s/register?invite=%s", appBaseURL(), token)
+	return sendEmail(email, "You Have Been Invited",
+		fmt.Sprintf("You have been invited to create an account. The invitation is valid until %s: <a href=\"%s\">%s</a>", expires.Format(time.RFC1123), inviteLink, inviteLink))
+}
+
+// SendErasureScheduledEmail confirms an account erasure request and says how
+// long the user has to cancel it.
+func SendErasureScheduledEmail(email string, erasureAt time.Time) error {
+	return sendEmail(email, "Your Account Will Be Deleted",
+		fmt.Sprintf("We received a request to delete your account and all of its data. It will be erased on %s. If you did not ask for this, sign in and cancel the request before then.", erasureAt.Format(time.RFC1123)))
+}
+
+// sendEmail delivers an HTML email through SMTP, or prints it to the log when
+// SMTP is not configured. When SMTP_TEST is set every email goes to that
+// address instead of the real recipient.
+func sendEmail(to, subject, body string) error {
 	// Get SMTP configuration from environment variables
-	// email : not used in this
 	smtpHost := os.Getenv("SMTP_HOST")
 	smtpPortStr := os.Getenv("SMTP_PORT")
 	smtpUser := os.Getenv("SMTP_USER")
 	smtpPass := os.Getenv("SMTP_PASS")
 	smtpTEST := os.Getenv("SMTP_TEST")
-	if smtpHost == "" || smtpPortStr == "" || smtpUser == "" || smtpPass == "" {
+	if !smtpConfigured() {
 		log.Println("WARNING: SMTP environment variables not fully configured. Falling back to console output.")
-		return logSimulatedEmail(email, token)
+		return logEmail(to, subject, body)
 	}
 
 	smtpPort, err := strconv.Atoi(smtpPortStr)
@@ -31,40 +86,65 @@ func SendPasswordResetEmail(email, token string) error {
 		return err
 	}
 
-	// Construct the reset link
-	// In a real app, the base URL should come from config
-	resetLink := fmt.Sprintf("http://localhost:3003/reset-password?token=%s", token)
+	recipient := to
+	if smtpTEST != "" {
+		recipient = smtpTEST
+	}
 
 	// Create a new email message
 	m := gomail.NewMessage()
 	m.SetHeader("From", smtpUser) // Or a specific "From" address
-	m.SetHeader("To", smtpTEST)
-	m.SetHeader("Subject", "Reset Your Password")
-	m.SetBody("text/html", fmt.Sprintf("To reset your password, please click the following link: <a href=\"%s\">%s</a>", resetLink, resetLink))
+	m.SetHeader("To", recipient)
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/html", body)
 
 	// Create a new Dialer
 	d := gomail.NewDialer(smtpHost, smtpPort, smtpUser, smtpPass)
 
 	// Send the email
-	log.Printf("Attempting to send password reset email to %s via SMTP...", email)
+	log.Printf("Attempting to send %q email to %s via SMTP...", subject, to)
 	if err := d.DialAndSend(m); err != nil {
 		log.Printf("ERROR: Failed to send email: %v", err)
 		return err
 	}
 
-	log.Printf("Successfully sent password reset email to %s", email)
+	log.Printf("Successfully sent %q email to %s", subject, to)
 	return nil
 }
 
+func smtpConfigured() bool {
+	return os.Getenv("SMTP_HOST") != "" && os.Getenv("SMTP_PORT") != "" &&
+		os.Getenv("SMTP_USER") != "" && os.Getenv("SMTP_PASS") != ""
+}
+
+func apiBaseURL() string {
+	if base := os.Getenv("API_BASE_URL"); base != "" {
+		return base
+	}
+	return "http://localhost:8080"
+}
+
+func appBaseURL() string {
+	if base := os.Getenv("APP_BASE_URL"); base != "" {
+		return base
+	}
+	return "http://localhost:3003"
+}
+
 // logSimulatedEmail is the fallback for when SMTP is not configured.
 func logSimulatedEmail(email, token string) error {
+	log.Println("WARNING: SMTP environment variables not fully configured. Falling back to console output.")
 	resetLink := fmt.Sprintf("http://localhost:8080/reset-password-page?token=%s", token)
+	return logEmail(email, "Reset Your Password",
+		fmt.Sprintf("To reset your password, please click the following link: %s", resetLink))
+}
 
+func logEmail(to, subject, body string) error {
 	log.Println("========================================================")
-	log.Printf("SIMULATING SENDING PASSWORD RESET EMAIL")
-	log.Printf("To: %s", email)
-	log.Printf("Subject: Reset Your Password")
-	log.Printf("Body: To reset your password, please click the following link: %s", resetLink)
+	log.Printf("SIMULATING SENDING EMAIL")
+	log.Printf("To: %s", to)
+	log.Printf("Subject: %s", subject)
+	log.Printf("Body: %s", body)
 	log.Println("========================================================")
 	return nil
 }
@@ -0,0 +1,369 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrJWTNotConfigured is returned when no signing key can be loaded.
+var ErrJWTNotConfigured = errors.New("JWT is not configured on the server")
+
+// signingKey is one key known to the KeyManager. Keys loaded from a public
+// key file have no private part and are only used for verification.
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+	secret  []byte // HS256 only
+}
+
+// KeyManager signs tokens with the active key and verifies them with any key
+// it still knows about, so tokens signed before a rotation stay valid until
+// they expire.
+//
+// Configuration (environment variables):
+//
+//	JWT_ALG         HS256 (default), RS256 or EdDSA
+//	JWT_SECRET      shared secret for HS256; while it is set, HS256 tokens are
+//	                still accepted after switching to an asymmetric algorithm
+//	JWT_KEYS_DIR    directory holding <kid>.pem private keys and, for retired
+//	                keys, <kid>.pub.pem public keys
+//	JWT_ACTIVE_KID  kid used for signing; defaults to the newest private key
+type KeyManager struct {
+	mu      sync.RWMutex
+	method  jwt.SigningMethod
+	dir     string
+	active  *signingKey
+	keys    map[string]*signingKey
+	hmacKey *signingKey
+}
+
+var (
+	keyManager     *KeyManager
+	keyManagerErr  error
+	keyManagerOnce sync.Once
+)
+
+// Keys returns the process wide KeyManager, loading it on first use.
+func Keys() (*KeyManager, error) {
+	keyManagerOnce.Do(func() {
+		keyManager, keyManagerErr = newKeyManager()
+		if keyManagerErr != nil {
+			log.Printf("ERROR: Failed to load JWT keys: %v", keyManagerErr)
+		}
+	})
+	return keyManager, keyManagerErr
+}
+
+func newKeyManager() (*KeyManager, error) {
+	km := &KeyManager{keys: map[string]*signingKey{}, dir: os.Getenv("JWT_KEYS_DIR")}
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		km.hmacKey = &signingKey{kid: "hmac", method: jwt.SigningMethodHS256, secret: []byte(secret)}
+	}
+
+	switch strings.ToUpper(os.Getenv("JWT_ALG")) {
+	case "", "HS256":
+		km.method = jwt.SigningMethodHS256
+		km.active = km.hmacKey
+		return km, nil
+	case "RS256":
+		km.method = jwt.SigningMethodRS256
+	case "EDDSA":
+		km.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALG %q", os.Getenv("JWT_ALG"))
+	}
+
+	if km.dir != "" {
+		if err := km.loadDir(os.Getenv("JWT_ACTIVE_KID")); err != nil {
+			return nil, err
+		}
+	}
+	if km.active == nil {
+		if km.dir == "" {
+			log.Println("WARNING: JWT_KEYS_DIR is not set. Generating an ephemeral signing key; tokens will not survive a restart.")
+		}
+		if _, err := km.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return km, nil
+}
+
+// loadDir reads every key in the keys directory. Private keys are sorted by
+// modification time so the newest one becomes active unless activeKid is set.
+func (km *KeyManager) loadDir(activeKid string) error {
+	entries, err := os.ReadDir(km.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	type loaded struct {
+		key     *signingKey
+		modTime int64
+	}
+	var privates []loaded
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".pem") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(km.dir, name))
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if kid, ok := strings.CutSuffix(name, ".pub.pem"); ok {
+			key, err := parsePublicKeyPEM(kid, data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			km.keys[kid] = key
+			continue
+		}
+		kid := strings.TrimSuffix(name, ".pem")
+		key, err := parsePrivateKeyPEM(kid, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		km.keys[kid] = key
+		if key.method == km.method {
+			privates = append(privates, loaded{key, info.ModTime().UnixNano()})
+		}
+	}
+
+	sort.Slice(privates, func(i, j int) bool { return privates[i].modTime > privates[j].modTime })
+	for _, p := range privates {
+		if activeKid == "" || p.key.kid == activeKid {
+			km.active = p.key
+			return nil
+		}
+	}
+	if activeKid != "" {
+		return fmt.Errorf("JWT_ACTIVE_KID %q has no matching %s private key", activeKid, km.method.Alg())
+	}
+	return nil
+}
+
+// Rotate generates a new signing key and makes it active. The previous keys
+// are kept for verification. When JWT_KEYS_DIR is set the new key is written
+// there so it survives a restart.
+func (km *KeyManager) Rotate() (string, error) {
+	var signer crypto.Signer
+	var err error
+	switch km.method {
+	case jwt.SigningMethodRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", errors.New("key rotation is only supported for RS256 and EdDSA")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	kid := base64.RawURLEncoding.EncodeToString(sum[:12])
+	key := &signingKey{kid: kid, method: km.method, private: signer, public: signer.Public()}
+
+	if km.dir != "" {
+		privDER, err := x509.MarshalPKCS8PrivateKey(signer)
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(km.dir, 0o700); err != nil {
+			return "", err
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER})
+		if err := os.WriteFile(filepath.Join(km.dir, kid+".pem"), data, 0o600); err != nil {
+			return "", err
+		}
+	}
+
+	km.mu.Lock()
+	km.keys[kid] = key
+	km.active = key
+	km.mu.Unlock()
+	log.Printf("JWT signing key rotated, active kid: %s", kid)
+	return kid, nil
+}
+
+// Sign signs the claims with the active key and stamps its kid in the header.
+func (km *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	km.mu.RLock()
+	key := km.active
+	km.mu.RUnlock()
+	if key == nil {
+		return "", ErrJWTNotConfigured
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	if key.secret != nil {
+		return token.SignedString(key.secret)
+	}
+	return token.SignedString(key.private)
+}
+
+// Parse verifies the token against the key named by its kid header. HS256
+// tokens, including old ones without a kid, are checked with JWT_SECRET.
+func (km *KeyManager) Parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, km.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+func (km *KeyManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if km.hmacKey == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return km.hmacKey.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	km.mu.RLock()
+	key, ok := km.keys[kid]
+	km.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if key.method.Alg() != token.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public keys in JSON Web Key Set format. HMAC secrets are
+// never published.
+func (km *KeyManager) JWKS() map[string]interface{} {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	kids := make([]string, 0, len(km.keys))
+	for kid := range km.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	keys := []map[string]string{}
+	for _, kid := range kids {
+		key := km.keys[kid]
+		jwk := map[string]string{"kid": kid, "use": "sig", "alg": key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+// SignToken signs claims with the process wide KeyManager.
+func SignToken(claims jwt.Claims) (string, error) {
+	km, err := Keys()
+	if err != nil {
+		return "", err
+	}
+	return km.Sign(claims)
+}
+
+// ParseToken verifies a token with the process wide KeyManager.
+func ParseToken(tokenString string) (jwt.MapClaims, error) {
+	km, err := Keys()
+	if err != nil {
+		return nil, err
+	}
+	return km.Parse(tokenString)
+}
+
+func parsePrivateKeyPEM(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, private: k, public: k.Public()}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, private: k, public: k.Public()}, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", parsed)
+}
+
+func parsePublicKeyPEM(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PublicKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, public: k}, nil
+	case ed25519.PublicKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, public: k}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", parsed)
+}
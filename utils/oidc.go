@@ -0,0 +1,349 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCProvider is an OpenID Connect identity provider we act as a relying
+// party for. Providers are configured with environment variables:
+//
+//	OIDC_PROVIDERS                 comma separated provider names, e.g. "corp,google"
+//	OIDC_<NAME>_ISSUER             issuer URL, used for discovery
+//	OIDC_<NAME>_CLIENT_ID
+//	OIDC_<NAME>_CLIENT_SECRET      optional for public clients (PKCE only)
+//	OIDC_<NAME>_REDIRECT_URL       our callback, .../auth/oidc/<name>/callback
+//	OIDC_<NAME>_SCOPES             default "openid email profile"
+//
+// The issuer may be a plain http URL, which makes it easy to run against a
+// local mock issuer.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	mu        sync.Mutex
+	discovery *OIDCDiscovery
+	jwks      map[string]interface{}
+	jwksAt    time.Time
+}
+
+// OIDCDiscovery holds the fields of the discovery document we use.
+type OIDCDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDTokenClaims are the ID token claims needed to link an identity.
+type IDTokenClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+const oidcJWKSRefreshInterval = 5 * time.Minute
+
+var (
+	oidcProviders     map[string]*OIDCProvider
+	oidcProvidersOnce sync.Once
+	oidcHTTPClient    = &http.Client{Timeout: 10 * time.Second}
+)
+
+// OIDCProviders returns the configured providers keyed by name.
+func OIDCProviders() map[string]*OIDCProvider {
+	oidcProvidersOnce.Do(func() {
+		oidcProviders = map[string]*OIDCProvider{}
+		for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			env := func(key string) string {
+				return os.Getenv("OIDC_" + strings.ToUpper(name) + "_" + key)
+			}
+			scopes := strings.Fields(env("SCOPES"))
+			if len(scopes) == 0 {
+				scopes = []string{"openid", "email", "profile"}
+			}
+			oidcProviders[name] = &OIDCProvider{
+				Name:         name,
+				Issuer:       strings.TrimSuffix(env("ISSUER"), "/"),
+				ClientID:     env("CLIENT_ID"),
+				ClientSecret: env("CLIENT_SECRET"),
+				RedirectURL:  env("REDIRECT_URL"),
+				Scopes:       scopes,
+			}
+		}
+	})
+	return oidcProviders
+}
+
+// NewPKCE returns a PKCE code verifier and its S256 challenge.
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// Discover fetches and caches the provider's discovery document.
+func (p *OIDCProvider) Discover(ctx context.Context) (*OIDCDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc OIDCDiscovery
+	if err := getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch %q", doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete discovery document")
+	}
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// AuthCodeURL builds the authorization request for the code flow with PKCE.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientID)
+	v.Set("redirect_uri", p.RedirectURL)
+	v.Set("scope", strings.Join(p.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", codeChallenge)
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return doc.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange redeems the authorization code and returns the raw ID token.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	doc, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc token endpoint returned %d: %s", resp.StatusCode, body)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return "", err
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("oidc token response has no id_token")
+	}
+	return tokens.IDToken, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token (OpenID Connect Core 3.1.3.7).
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDTokenClaims, error) {
+	doc, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, doc.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	if n, _ := claims["nonce"].(string); n == "" || n != nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.ClientID {
+			return nil, errors.New("id token azp mismatch")
+		}
+	}
+
+	result := &IDTokenClaims{}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string: // some providers send "true"
+		result.EmailVerified = v == "true"
+	}
+	if result.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	return result, nil
+}
+
+// publicKey returns the JWKS key for kid, refetching the key set when the
+// kid is unknown so provider key rotation is picked up.
+func (p *OIDCProvider) publicKey(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.jwks[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.jwksAt) < 10*time.Second && p.jwks != nil {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		case "OKP":
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+				continue
+			}
+			keys[k.Kid] = ed25519.PublicKey(x)
+		}
+	}
+	p.jwks, p.jwksAt = keys, time.Now()
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+func getJSON(ctx context.Context, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
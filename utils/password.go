@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes passwords with one algorithm. Hashes are stored in a
+// self-describing format ("$2b$..." for bcrypt, PHC "$argon2id$..." for
+// argon2id), so hashes of every supported algorithm can be verified at once.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of password.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches an encoded hash of this algorithm.
+	Verify(encoded, password string) (bool, error)
+	// Owns reports whether the encoded hash was made by this algorithm.
+	Owns(encoded string) bool
+	// Outdated reports whether the hash uses weaker parameters than configured.
+	Outdated(encoded string) bool
+}
+
+var errUnknownPasswordHash = errors.New("unknown password hash format")
+
+// PasswordHashers returns the configured hasher first, followed by the other
+// supported ones. It is set with:
+//
+//	PASSWORD_HASH_ALGORITHM   bcrypt (default) or argon2id
+//	BCRYPT_COST               4-31, default 10 (bcrypt.DefaultCost)
+//	ARGON2_MEMORY             memory in KiB, at least 8 per thread, default 65536 (64 MiB)
+//	ARGON2_TIME               iterations, at least 1, default 3
+//	ARGON2_THREADS            parallelism, 1-255, default 2
+//
+// The settings are read once; invalid ones stop the server, so call it at
+// startup.
+func PasswordHashers() []PasswordHasher {
+	passwordHashersOnce.Do(func() {
+		bcryptHasher := BcryptHasher{Cost: passwordHashSetting("BCRYPT_COST", bcrypt.DefaultCost, bcrypt.MinCost, bcrypt.MaxCost)}
+		threads := passwordHashSetting("ARGON2_THREADS", 2, 1, math.MaxUint8)
+		argonHasher := Argon2idHasher{
+			Memory:  uint32(passwordHashSetting("ARGON2_MEMORY", 64*1024, 8*threads, math.MaxUint32)),
+			Time:    uint32(passwordHashSetting("ARGON2_TIME", 3, 1, math.MaxUint32)),
+			Threads: uint8(threads),
+			SaltLen: 16,
+			KeyLen:  32,
+		}
+		passwordHashers = []PasswordHasher{bcryptHasher, argonHasher}
+		if strings.EqualFold(os.Getenv("PASSWORD_HASH_ALGORITHM"), "argon2id") {
+			passwordHashers = []PasswordHasher{argonHasher, bcryptHasher}
+		}
+	})
+	return passwordHashers
+}
+
+var (
+	passwordHashers     []PasswordHasher
+	passwordHashersOnce sync.Once
+)
+
+// passwordHashSetting reads an integer setting between low and high. Unset
+// settings use fallback; invalid ones stop the server.
+func passwordHashSetting(name string, fallback, low, high int) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < low || n > high {
+		log.Fatalf("FATAL: Invalid %s %q, must be between %d and %d", name, value, low, high)
+	}
+	return n
+}
+
+// HashPassword hashes a password with the configured algorithm.
+func HashPassword(password string) (string, error) {
+	return PasswordHashers()[0].Hash(password)
+}
+
+// VerifyPassword checks a password against a stored hash of any supported
+// algorithm. needsRehash is true when the password matched but the hash
+// should be replaced by HashPassword, because it uses another algorithm or
+// outdated parameters.
+func VerifyPassword(encoded, password string) (ok, needsRehash bool) {
+	hashers := PasswordHashers()
+	for i, hasher := range hashers {
+		if !hasher.Owns(encoded) {
+			continue
+		}
+		ok, err := hasher.Verify(encoded, password)
+		if err != nil || !ok {
+			return false, false
+		}
+		return true, i != 0 || hasher.Outdated(encoded)
+	}
+	return false, false
+}
+
+// BcryptHasher hashes passwords with bcrypt.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h BcryptHasher) Owns(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h BcryptHasher) Outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < h.Cost
+}
+
+// Argon2idHasher hashes passwords with argon2id and encodes them in the PHC
+// string format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>.
+type Argon2idHasher struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen int
+	KeyLen  uint32
+}
+
+type argon2Params struct {
+	memory, time uint32
+	threads      uint8
+	salt, key    []byte
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Verify(encoded, password string) (bool, error) {
+	p, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (h Argon2idHasher) Owns(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h Argon2idHasher) Outdated(encoded string) bool {
+	p, err := decodeArgon2id(encoded)
+	return err != nil || p.memory < h.Memory || p.time < h.Time || p.threads < h.Threads ||
+		len(p.salt) < h.SaltLen || uint32(len(p.key)) < h.KeyLen
+}
+
+func decodeArgon2id(encoded string) (argon2Params, error) {
+	var p argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, errUnknownPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, errUnknownPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, errUnknownPasswordHash
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, errUnknownPasswordHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return p, errUnknownPasswordHash
+	}
+	return p, nil
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordViolation describes one rule a password failed.
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy is read from the environment by LoadPasswordPolicy:
+//
+//	PASSWORD_MIN_LENGTH       minimum number of characters (default 8)
+//	PASSWORD_MAX_BYTES        maximum length in bytes (default 72, bcrypt's limit)
+//	PASSWORD_REQUIRE          comma separated classes: lower, upper, digit, symbol
+//	BREACHED_PASSWORDS_PATH   optional breached password list, either a
+//	                          directory of k-anonymity range files named after
+//	                          the 5 character SHA-1 prefix (lines "SUFFIX:COUNT"),
+//	                          or a single file of full "SHA1:COUNT" lines
+type PasswordPolicy struct {
+	MinLength     int
+	MaxBytes      int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	BreachedPath  string
+}
+
+func LoadPasswordPolicy() PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength:    envInt("PASSWORD_MIN_LENGTH", 8),
+		MaxBytes:     envInt("PASSWORD_MAX_BYTES", 72),
+		BreachedPath: os.Getenv("BREACHED_PASSWORDS_PATH"),
+	}
+	for _, class := range strings.Split(os.Getenv("PASSWORD_REQUIRE"), ",") {
+		switch strings.ToLower(strings.TrimSpace(class)) {
+		case "lower":
+			policy.RequireLower = true
+		case "upper":
+			policy.RequireUpper = true
+		case "digit":
+			policy.RequireDigit = true
+		case "symbol":
+			policy.RequireSymbol = true
+		}
+	}
+	return policy
+}
+
+// ValidatePassword checks the password against the configured policy. The
+// identifiers (email, username, ...) are values the password must not equal.
+func ValidatePassword(password string, identifiers ...string) []PasswordViolation {
+	return LoadPasswordPolicy().Validate(password, identifiers...)
+}
+
+// Validate returns every rule the password violates; an empty result means
+// the password is acceptable.
+func (p PasswordPolicy) Validate(password string, identifiers ...string) []PasswordViolation {
+	violations := []PasswordViolation{}
+	add := func(rule, format string, args ...interface{}) {
+		violations = append(violations, PasswordViolation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		add("min_length", "Password must be at least %d characters long.", p.MinLength)
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		add("max_length", "Password must be at most %d bytes long.", p.MaxBytes)
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireLower && !hasLower {
+		add("lowercase", "Password must contain a lowercase letter.")
+	}
+	if p.RequireUpper && !hasUpper {
+		add("uppercase", "Password must contain an uppercase letter.")
+	}
+	if p.RequireDigit && !hasDigit {
+		add("digit", "Password must contain a digit.")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		add("symbol", "Password must contain a symbol.")
+	}
+
+	for _, identifier := range identifiers {
+		if identifier == "" {
+			continue
+		}
+		local, _, _ := strings.Cut(identifier, "@")
+		if strings.EqualFold(password, identifier) || strings.EqualFold(password, local) {
+			add("not_identifier", "Password must not be the same as your email or username.")
+			break
+		}
+	}
+
+	if p.BreachedPath != "" && password != "" {
+		breached, err := isBreachedPassword(p.BreachedPath, password)
+		if err != nil {
+			log.Printf("WARNING: Breached password check failed: %v", err)
+		} else if breached {
+			add("breached", "Password has appeared in a data breach, choose a different one.")
+		}
+	}
+	return violations
+}
+
+// isBreachedPassword looks the SHA-1 of the password up in the local list.
+func isBreachedPassword(path, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	target, want := path, hash
+	if info.IsDir() {
+		// k-anonymity layout: one range file per prefix, holding only suffixes.
+		target, want = filepath.Join(path, prefix), suffix
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			target += ".txt"
+		}
+	}
+
+	f, err := os.Open(target)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(entry), want) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func envInt(name string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AbortWithProblem aborts the request with an RFC 7807 problem response.
+// The detail is also copied to "error" so clients that only read that key,
+// like for every other error in this API, keep working.
+func AbortWithProblem(c *gin.Context, status int, detail string, extra gin.H) {
+	problem := gin.H{
+		"type":   "about:blank",
+		"title":  http.StatusText(status),
+		"status": status,
+		"detail": detail,
+		"error":  detail,
+	}
+	for k, v := range extra {
+		problem[k] = v
+	}
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(status, problem)
+}
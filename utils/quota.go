@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"API/config"
+	"API/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Quota periods. Both start at midnight UTC.
+const (
+	QuotaDaily   = "daily"
+	QuotaMonthly = "monthly"
+)
+
+// QuotaSubject is who a quota is counted for: a user, or one of their API
+// keys.
+type QuotaSubject struct {
+	UserID   uint
+	APIKeyID uint
+}
+
+func (s QuotaSubject) String() string {
+	if s.APIKeyID != 0 {
+		return fmt.Sprintf("api_key:%d", s.APIKeyID)
+	}
+	return fmt.Sprintf("user:%d", s.UserID)
+}
+
+// QuotaSubjectsFromContext returns who the current request counts against:
+// the user and, when the request was made with an API key, also that key, so
+// a user cannot get around their quota by spreading requests over keys. It is
+// empty before RequireAuth has run.
+func QuotaSubjectsFromContext(c *gin.Context) []QuotaSubject {
+	user, ok := c.Get("user")
+	if !ok {
+		return nil
+	}
+	subjects := []QuotaSubject{{UserID: user.(models.User).Id}}
+	if key, ok := c.Get("api_key"); ok {
+		subjects = append(subjects, QuotaSubject{UserID: user.(models.User).Id, APIKeyID: key.(models.APIKey).ID})
+	}
+	return subjects
+}
+
+// QuotaUsage is the state of one quota period of a subject.
+type QuotaUsage struct {
+	Subject QuotaSubject `json:"-"`
+	Period  string       `json:"period"`
+	Limit   int64        `json:"limit"` // 0 means unlimited
+	Used    int64        `json:"used"`
+	Start   time.Time    `json:"start"`
+	// ResetAt is when the next period starts and Used goes back to zero.
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// Remaining is how many requests are left, or -1 when the quota is unlimited.
+func (q QuotaUsage) Remaining() int64 {
+	if q.Limit == 0 {
+		return -1
+	}
+	return max(q.Limit-q.Used, 0)
+}
+
+// UsedUp reports whether no requests are left in the period.
+func (q QuotaUsage) UsedUp() bool {
+	return q.Limit > 0 && q.Used >= q.Limit
+}
+
+func quotaPeriods(now time.Time) []QuotaUsage {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	daily, monthly := config.APIQuotas()
+	return []QuotaUsage{
+		{Period: QuotaDaily, Limit: daily, Start: day, ResetAt: day.AddDate(0, 0, 1)},
+		{Period: QuotaMonthly, Limit: monthly, Start: month, ResetAt: month.AddDate(0, 1, 0)},
+	}
+}
+
+// subjectQuotaPeriods returns the periods of every subject, in order.
+func subjectQuotaPeriods(subjects []QuotaSubject, now time.Time) []QuotaUsage {
+	var periods []QuotaUsage
+	for _, subject := range subjects {
+		for _, usage := range quotaPeriods(now) {
+			usage.Subject = subject
+			periods = append(periods, usage)
+		}
+	}
+	return periods
+}
+
+func quotaRedisKey(usage QuotaUsage) string {
+	return fmt.Sprintf("quota:%s:%s:%s", usage.Subject, usage.Period, usage.Start.Format("2006-01-02"))
+}
+
+// quotaScript counts a request against every period of every subject, unless
+// one of them is used up; then nothing is counted, so rejected requests do not
+// use up the other periods.
+// KEYS = counter per period, ARGV = limit per period (0 = unlimited), then the
+// Unix time each counter expires at. Returns {allowed, used per period}.
+var quotaScript = redis.NewScript(`
+local n = #KEYS
+local result = {1}
+for i = 1, n do
+	result[i + 1] = tonumber(redis.call('GET', KEYS[i]) or '0')
+	local limit = tonumber(ARGV[i])
+	if limit > 0 and result[i + 1] >= limit then
+		result[1] = 0
+	end
+end
+if result[1] == 1 then
+	for i = 1, n do
+		result[i + 1] = redis.call('INCR', KEYS[i])
+		redis.call('EXPIREAT', KEYS[i], ARGV[n + i])
+	end
+end
+return result
+`)
+
+var errQuotaUsedUp = errors.New("quota used up")
+
+// CountQuotaRequest adds one request to the daily and monthly usage of every
+// subject and returns the updated usage. When a quota of any subject is
+// already used up the request is not counted at all and allowed is false.
+// Counters live in Redis, or in the database while Redis is unavailable.
+func CountQuotaRequest(ctx context.Context, subjects []QuotaSubject, now time.Time) (periods []QuotaUsage, allowed bool, err error) {
+	periods = subjectQuotaPeriods(subjects, now)
+	if config.RedisClient != nil {
+		keys := make([]string, len(periods))
+		args := make([]interface{}, 0, 2*len(periods))
+		for i, usage := range periods {
+			keys[i] = quotaRedisKey(usage)
+			args = append(args, usage.Limit)
+		}
+		for _, usage := range periods {
+			// เก็บไว้เกินรอบไปอีกหนึ่งวันเผื่อนาฬิกาของแต่ละเครื่องไม่ตรงกัน
+			args = append(args, usage.ResetAt.Add(24*time.Hour).Unix())
+		}
+		result, err := quotaScript.Run(ctx, config.RedisClient, keys, args...).Int64Slice()
+		if err == nil && len(result) == len(periods)+1 {
+			for i := range periods {
+				periods[i].Used = result[i+1]
+			}
+			return periods, result[0] == 1, nil
+		}
+		log.Printf("WARNING: Failed to count quota in Redis, using the database: %v", err)
+	}
+
+	// ถ้ารอบใดเต็มแล้ว rollback ทั้งหมด เพื่อไม่ให้รอบอื่นถูกนับเพิ่ม
+	err = config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i, usage := range periods {
+			record := models.APIUsage{
+				UserID:      usage.Subject.UserID,
+				APIKeyID:    usage.Subject.APIKeyID,
+				Period:      usage.Period,
+				PeriodStart: usage.Start,
+				Count:       1,
+			}
+			onConflict := clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "api_key_id"}, {Name: "period"}, {Name: "period_start"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("api_usages.count + 1"), "updated_at": now}),
+			}
+			if usage.Limit > 0 {
+				onConflict.Where = clause.Where{Exprs: []clause.Expression{gorm.Expr("api_usages.count < ?", usage.Limit)}}
+			}
+			result := tx.Clauses(onConflict, clause.Returning{Columns: []clause.Column{{Name: "count"}}}).Create(&record)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				periods[i].Used = usage.Limit
+				return errQuotaUsedUp
+			}
+			periods[i].Used = record.Count
+		}
+		return nil
+	})
+	if errors.Is(err, errQuotaUsedUp) {
+		return periods, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return periods, true, nil
+}
+
+// GetQuotaUsage returns the subjects' current usage without counting a request.
+func GetQuotaUsage(ctx context.Context, subjects []QuotaSubject, now time.Time) ([]QuotaUsage, error) {
+	periods := subjectQuotaPeriods(subjects, now)
+	if config.RedisClient != nil {
+		keys := make([]string, len(periods))
+		for i, usage := range periods {
+			keys[i] = quotaRedisKey(usage)
+		}
+		values, err := config.RedisClient.MGet(ctx, keys...).Result()
+		if err == nil {
+			for i, value := range values {
+				if s, ok := value.(string); ok {
+					periods[i].Used, _ = strconv.ParseInt(s, 10, 64)
+				}
+			}
+			return clampQuotaUsage(periods), nil
+		}
+		log.Printf("WARNING: Failed to read quota from Redis, using the database: %v", err)
+	}
+
+	for i, usage := range periods {
+		var record models.APIUsage
+		err := config.DB.WithContext(ctx).
+			Where("user_id = ? AND api_key_id = ? AND period = ? AND period_start = ?", usage.Subject.UserID, usage.Subject.APIKeyID, usage.Period, usage.Start).
+			Limit(1).Find(&record).Error
+		if err != nil {
+			return nil, err
+		}
+		periods[i].Used = record.Count
+	}
+	return clampQuotaUsage(periods), nil
+}
+
+// clampQuotaUsage caps Used at Limit. Counters written before rejected
+// requests stopped being counted can be higher.
+func clampQuotaUsage(periods []QuotaUsage) []QuotaUsage {
+	for i, usage := range periods {
+		if usage.Limit > 0 && usage.Used > usage.Limit {
+			periods[i].Used = usage.Limit
+		}
+	}
+	return periods
+}
+
+// PurgeOldQuotaUsage deletes database counters of periods that have ended.
+func PurgeOldQuotaUsage(ctx context.Context, now time.Time) error {
+	month := quotaPeriods(now)[1].Start
+	return config.DB.WithContext(ctx).Where("period_start < ?", month).Delete(&models.APIUsage{}).Error
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"API/models"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQuotaPeriods(t *testing.T) {
+	t.Setenv("API_QUOTA_DAILY", "100")
+	t.Setenv("API_QUOTA_MONTHLY", "2000")
+	bangkok := time.FixedZone("ICT", 7*3600)
+	tests := []struct {
+		name                   string
+		now                    time.Time
+		dayStart, dayReset     string
+		monthStart, monthReset string
+	}{
+		{"mid month", time.Date(2026, 3, 15, 13, 0, 0, 0, time.UTC), "2026-03-15", "2026-03-16", "2026-03-01", "2026-04-01"},
+		{"last day of the year", time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC), "2026-12-31", "2027-01-01", "2026-12-01", "2027-01-01"},
+		{"leap day", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC), "2028-02-29", "2028-03-01", "2028-02-01", "2028-03-01"},
+		// 06:00 on the 1st in Bangkok is still the last day of the month in UTC
+		{"other time zone", time.Date(2026, 5, 1, 6, 0, 0, 0, bangkok), "2026-04-30", "2026-05-01", "2026-04-01", "2026-05-01"},
+	}
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			periods := quotaPeriods(tt.now)
+			if len(periods) != 2 {
+				t.Fatalf("got %d periods, want 2", len(periods))
+			}
+			daily, monthly := periods[0], periods[1]
+			if daily.Period != QuotaDaily || daily.Limit != 100 || !daily.Start.Equal(day(tt.dayStart)) || !daily.ResetAt.Equal(day(tt.dayReset)) {
+				t.Errorf("daily = %+v, want %s to %s with limit 100", daily, tt.dayStart, tt.dayReset)
+			}
+			if monthly.Period != QuotaMonthly || monthly.Limit != 2000 || !monthly.Start.Equal(day(tt.monthStart)) || !monthly.ResetAt.Equal(day(tt.monthReset)) {
+				t.Errorf("monthly = %+v, want %s to %s with limit 2000", monthly, tt.monthStart, tt.monthReset)
+			}
+		})
+	}
+}
+
+func TestQuotaUsage(t *testing.T) {
+	tests := []struct {
+		name        string
+		usage       QuotaUsage
+		remaining   int64
+		usedUp      bool
+		clampedUsed int64
+	}{
+		{"unlimited", QuotaUsage{Limit: 0, Used: 5000}, -1, false, 5000},
+		{"unused", QuotaUsage{Limit: 10}, 10, false, 0},
+		{"partly used", QuotaUsage{Limit: 10, Used: 4}, 6, false, 4},
+		{"used up", QuotaUsage{Limit: 10, Used: 10}, 0, true, 10},
+		// counted before rejected requests stopped being counted
+		{"over the limit", QuotaUsage{Limit: 10, Used: 13}, 0, true, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.usage.Remaining(); got != tt.remaining {
+				t.Errorf("Remaining() = %d, want %d", got, tt.remaining)
+			}
+			if got := tt.usage.UsedUp(); got != tt.usedUp {
+				t.Errorf("UsedUp() = %v, want %v", got, tt.usedUp)
+			}
+			if got := clampQuotaUsage([]QuotaUsage{tt.usage})[0].Used; got != tt.clampedUsed {
+				t.Errorf("clamped Used = %d, want %d", got, tt.clampedUsed)
+			}
+		})
+	}
+}
+
+func TestSubjectQuotaPeriods(t *testing.T) {
+	now := time.Date(2026, 3, 15, 13, 0, 0, 0, time.UTC)
+	user := QuotaSubject{UserID: 4}
+	key := QuotaSubject{UserID: 4, APIKeyID: 9}
+	periods := subjectQuotaPeriods([]QuotaSubject{user, key}, now)
+
+	want := []string{
+		"quota:user:4:daily:2026-03-15",
+		"quota:user:4:monthly:2026-03-01",
+		"quota:api_key:9:daily:2026-03-15",
+		"quota:api_key:9:monthly:2026-03-01",
+	}
+	if len(periods) != len(want) {
+		t.Fatalf("got %d periods, want %d", len(periods), len(want))
+	}
+	for i, usage := range periods {
+		if got := quotaRedisKey(usage); got != want[i] {
+			t.Errorf("period %d: key %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestQuotaSubjectsFromContext(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(c *gin.Context)
+		want []QuotaSubject
+	}{
+		{"not authenticated", func(c *gin.Context) {}, nil},
+		{"token", func(c *gin.Context) { c.Set("user", models.User{Id: 4}) }, []QuotaSubject{{UserID: 4}}},
+		{"api key", func(c *gin.Context) {
+			c.Set("user", models.User{Id: 4})
+			c.Set("api_key", models.APIKey{ID: 9})
+		}, []QuotaSubject{{UserID: 4}, {UserID: 4, APIKeyID: 9}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			tt.set(c)
+			if got := QuotaSubjectsFromContext(c); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("subjects = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"API/config"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitResult is the outcome of one rate limited request.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	// RetryAfter is how long to wait before the next request is allowed. It is
+	// zero when the request was allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the full budget is available again.
+	ResetAfter time.Duration
+}
+
+// Both scripts read the clock with TIME so every API instance uses the Redis
+// server's time, and return {allowed, remaining, retry_after_ms, reset_after_ms}.
+
+// slidingWindowScript keeps one sorted set entry per allowed request, scored
+// by its time in milliseconds.
+// KEYS[1] = log key, ARGV = limit, period_ms, unique member
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - period)
+local count = redis.call('ZCARD', KEYS[1])
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[3])
+	redis.call('PEXPIRE', KEYS[1], period)
+	return {1, limit - count - 1, 0, period}
+end
+
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+local retry = tonumber(oldest[2]) + period - now
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+return {0, 0, retry, tonumber(newest[2]) + period - now}
+`)
+
+// tokenBucketScript stores the tokens left and the time they were counted.
+// KEYS[1] = bucket key, ARGV = capacity, period_ms
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local rate = capacity / period
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], period)
+return {allowed, math.floor(tokens), retry, math.ceil((capacity - tokens) / rate)}
+`)
+
+// ErrRateLimitUnavailable is returned by AllowRequest when Redis cannot be
+// used and the policy fails closed.
+var ErrRateLimitUnavailable = errors.New("rate limiting is unavailable")
+
+// redisRateLimitRetryDelay is how long rate limiting stays in memory after a
+// Redis error before Redis is tried again, so an outage does not add a Redis
+// timeout to every request.
+const redisRateLimitRetryDelay = 5 * time.Second
+
+var redisRateLimitRetryAt atomic.Int64 // unix nanoseconds
+
+// AllowRequest counts one request against the policy's budget for key. When
+// Redis is unavailable or fails, the policy's OnFailure decides: count in
+// memory, allow the request, or return ErrRateLimitUnavailable.
+func AllowRequest(ctx context.Context, policy config.RateLimitPolicy, key string) (RateLimitResult, error) {
+	if config.RedisClient != nil && time.Now().UnixNano() >= redisRateLimitRetryAt.Load() {
+		result, err := allowRedis(ctx, policy, key)
+		if err == nil {
+			return result, nil
+		}
+		log.Printf("WARNING: Redis rate limit for policy %s failed, falling back to %s: %v", policy.Name, policy.OnFailure, err)
+		// A canceled or timed out request says nothing about Redis, so only
+		// Redis and network errors keep the next requests away from it. The
+		// request's own context is checked rather than the error, because
+		// network timeouts match context.DeadlineExceeded too.
+		if ctx.Err() == nil {
+			redisRateLimitRetryAt.Store(time.Now().Add(redisRateLimitRetryDelay).UnixNano())
+		}
+	}
+
+	switch policy.OnFailure {
+	case config.RateLimitFailOpen:
+		return RateLimitResult{Allowed: true, Limit: policy.Limit, Remaining: policy.Limit}, nil
+	case config.RateLimitFailClosed:
+		return RateLimitResult{}, ErrRateLimitUnavailable
+	default:
+		return localRateLimit().allow(policy, key, time.Now()), nil
+	}
+}
+
+func allowRedis(ctx context.Context, policy config.RateLimitPolicy, key string) (RateLimitResult, error) {
+	period := policy.Period.Milliseconds()
+
+	var values []int64
+	var err error
+	switch policy.Algorithm {
+	case config.RateLimitTokenBucket:
+		values, err = tokenBucketScript.Run(ctx, config.RedisClient, []string{key}, policy.Limit, period).Int64Slice()
+	case config.RateLimitSlidingWindow:
+		var member string
+		if member, err = RandomToken(12); err != nil {
+			return RateLimitResult{}, err
+		}
+		values, err = slidingWindowScript.Run(ctx, config.RedisClient, []string{key}, policy.Limit, period, member).Int64Slice()
+	default:
+		return RateLimitResult{}, fmt.Errorf("unknown rate limit algorithm %q", policy.Algorithm)
+	}
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if len(values) != 4 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit script result %v", values)
+	}
+	return RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      policy.Limit,
+		Remaining:  values[1],
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		ResetAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
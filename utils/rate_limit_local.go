@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"API/config"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	localRateLimitShards  = 64
+	localRateLimitCleanup = time.Minute
+)
+
+// localRateLimiter counts requests in memory while Redis is unavailable. The
+// keys are spread over shards so concurrent requests rarely wait on the same
+// lock. Budgets are per API instance, not shared between instances.
+type localRateLimiter struct {
+	shards [localRateLimitShards]localRateLimitShard
+}
+
+type localRateLimitShard struct {
+	mu      sync.Mutex
+	entries map[string]*localRateLimitEntry
+}
+
+type localRateLimitEntry struct {
+	hits      []time.Time // sliding window: times of the allowed requests
+	tokens    float64     // token bucket: tokens left at updated
+	updated   time.Time
+	expiresAt time.Time
+}
+
+var (
+	localLimiter     *localRateLimiter
+	localLimiterOnce sync.Once
+)
+
+// localRateLimit returns the process wide limiter and starts its cleanup loop
+// the first time it is needed.
+func localRateLimit() *localRateLimiter {
+	localLimiterOnce.Do(func() {
+		localLimiter = &localRateLimiter{}
+		for i := range localLimiter.shards {
+			localLimiter.shards[i].entries = map[string]*localRateLimitEntry{}
+		}
+		go func() {
+			for range time.Tick(localRateLimitCleanup) {
+				localLimiter.cleanup(time.Now())
+			}
+		}()
+	})
+	return localLimiter
+}
+
+func (l *localRateLimiter) shard(key string) *localRateLimitShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &l.shards[h.Sum32()%localRateLimitShards]
+}
+
+// cleanup drops the counters that have not been used for a whole period.
+func (l *localRateLimiter) cleanup(now time.Time) {
+	for i := range l.shards {
+		shard := &l.shards[i]
+		shard.mu.Lock()
+		for key, entry := range shard.entries {
+			if now.After(entry.expiresAt) {
+				delete(shard.entries, key)
+			}
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// allow implements the same algorithms as the Redis scripts.
+func (l *localRateLimiter) allow(policy config.RateLimitPolicy, key string, now time.Time) RateLimitResult {
+	shard := l.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	entry, ok := shard.entries[key]
+	if !ok {
+		entry = &localRateLimitEntry{tokens: float64(policy.Limit), updated: now}
+		shard.entries[key] = entry
+	}
+	entry.expiresAt = now.Add(policy.Period)
+	result := RateLimitResult{Limit: policy.Limit}
+
+	if policy.Algorithm == config.RateLimitTokenBucket {
+		rate := float64(policy.Limit) / float64(policy.Period)
+		if elapsed := now.Sub(entry.updated); elapsed > 0 {
+			entry.tokens = math.Min(float64(policy.Limit), entry.tokens+float64(elapsed)*rate)
+		}
+		entry.updated = now
+		if entry.tokens >= 1 {
+			entry.tokens--
+			result.Allowed = true
+		} else {
+			result.RetryAfter = time.Duration(math.Ceil((1 - entry.tokens) / rate))
+		}
+		result.Remaining = int64(entry.tokens)
+		result.ResetAfter = time.Duration(math.Ceil((float64(policy.Limit) - entry.tokens) / rate))
+		return result
+	}
+
+	// sliding window: ลบคำขอที่อยู่นอกช่วงเวลาออกก่อน
+	windowStart := now.Add(-policy.Period)
+	kept := entry.hits[:0]
+	for _, hit := range entry.hits {
+		if hit.After(windowStart) {
+			kept = append(kept, hit)
+		}
+	}
+	entry.hits = kept
+
+	if int64(len(entry.hits)) < policy.Limit {
+		entry.hits = append(entry.hits, now)
+		result.Allowed = true
+		result.Remaining = policy.Limit - int64(len(entry.hits))
+		result.ResetAfter = policy.Period
+		return result
+	}
+	result.RetryAfter = entry.hits[0].Add(policy.Period).Sub(now)
+	result.ResetAfter = entry.hits[len(entry.hits)-1].Add(policy.Period).Sub(now)
+	return result
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"API/config"
+	"testing"
+	"time"
+)
+
+func newTestLocalLimiter() *localRateLimiter {
+	l := &localRateLimiter{}
+	for i := range l.shards {
+		l.shards[i].entries = map[string]*localRateLimitEntry{}
+	}
+	return l
+}
+
+// localStep is one request at offset from the start of the test and what the
+// limiter should answer.
+type localStep struct {
+	offset     time.Duration
+	allowed    bool
+	remaining  int64
+	retryAfter time.Duration
+}
+
+func TestLocalRateLimiter(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy config.RateLimitPolicy
+		steps  []localStep
+	}{
+		{
+			name:   "sliding window",
+			policy: config.RateLimitPolicy{Algorithm: config.RateLimitSlidingWindow, Limit: 3, Period: time.Minute},
+			steps: []localStep{
+				{0, true, 2, 0},
+				{20 * time.Second, true, 1, 0},
+				{40 * time.Second, true, 0, 0},
+				{50 * time.Second, false, 0, 10 * time.Second},
+				// the first request has left the window
+				{61 * time.Second, true, 0, 0},
+				{62 * time.Second, false, 0, 18 * time.Second},
+				{101 * time.Second, true, 1, 0},
+			},
+		},
+		{
+			name:   "token bucket",
+			policy: config.RateLimitPolicy{Algorithm: config.RateLimitTokenBucket, Limit: 4, Period: 4 * time.Second},
+			steps: []localStep{
+				{0, true, 3, 0},
+				{0, true, 2, 0},
+				{0, true, 1, 0},
+				{0, true, 0, 0},
+				{0, false, 0, time.Second},
+				{500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+				{time.Second, true, 0, 0},
+				// refilled, but never above the limit
+				{time.Minute, true, 3, 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLocalLimiter()
+			start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			for i, step := range tt.steps {
+				got := l.allow(tt.policy, "key", start.Add(step.offset))
+				if got.Allowed != step.allowed || got.Remaining != step.remaining || got.RetryAfter != step.retryAfter {
+					t.Fatalf("step %d at %v: got allowed=%v remaining=%d retry=%v, want allowed=%v remaining=%d retry=%v",
+						i, step.offset, got.Allowed, got.Remaining, got.RetryAfter, step.allowed, step.remaining, step.retryAfter)
+				}
+				if got.Limit != tt.policy.Limit {
+					t.Fatalf("step %d: limit %d, want %d", i, got.Limit, tt.policy.Limit)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalRateLimiterKeysAreIndependent(t *testing.T) {
+	l := newTestLocalLimiter()
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitSlidingWindow, Limit: 1, Period: time.Minute}
+	now := time.Now()
+	if !l.allow(policy, "a", now).Allowed || l.allow(policy, "a", now).Allowed {
+		t.Fatal("key a: want one request allowed")
+	}
+	if !l.allow(policy, "b", now).Allowed {
+		t.Fatal("key b was limited by the requests of key a")
+	}
+}
+
+func TestLocalRateLimiterCleanup(t *testing.T) {
+	l := newTestLocalLimiter()
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitTokenBucket, Limit: 1, Period: time.Minute}
+	now := time.Now()
+	l.allow(policy, "old", now)
+	l.allow(policy, "recent", now.Add(30*time.Second))
+
+	l.cleanup(now.Add(90 * time.Second))
+	if _, ok := l.shard("old").entries["old"]; ok {
+		t.Error("an entry unused for a whole period was kept")
+	}
+	if _, ok := l.shard("recent").entries["recent"]; !ok {
+		t.Error("an entry still in its period was dropped")
+	}
+}
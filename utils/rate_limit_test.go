@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"API/config"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeRedis speaks just enough RESP for these tests: GET, SET (with NX) and
+// DEL on an in-memory map, which ignores TTLs, and every EVAL/EVALSHA gets an
+// allowed result with 42 remaining, so tests can tell it apart from the
+// in-memory limiter.
+type fakeRedis struct {
+	ln    net.Listener
+	evals atomic.Int64
+
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeRedis{ln: ln, data: map[string]string{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRESPArray(r)
+		if err != nil {
+			return
+		}
+		fmt.Fprint(conn, f.reply(args))
+	}
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "HELLO":
+		return "-ERR unknown command\r\n"
+	case "EVAL", "EVALSHA":
+		f.evals.Add(1)
+		return "*4\r\n:1\r\n:42\r\n:0\r\n:1000\r\n"
+	case "GET":
+		value, ok := f.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		if _, exists := f.data[args[1]]; exists && slices.ContainsFunc(args[3:], func(a string) bool { return strings.EqualFold(a, "NX") }) {
+			return "$-1\r\n"
+		}
+		f.data[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := f.data[key]; ok {
+				delete(f.data, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	default:
+		return "+OK\r\n"
+	}
+}
+
+func (f *fakeRedis) get(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.data[key]
+	return value, ok
+}
+
+func readRESPArray(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func useRedis(t *testing.T, addr string) {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, DialTimeout: 200 * time.Millisecond})
+	previous := config.RedisClient
+	config.RedisClient = client
+	t.Cleanup(func() {
+		client.Close()
+		config.RedisClient = previous
+	})
+}
+
+func TestAllowRequestFallsBackAndRecovers(t *testing.T) {
+	redisRateLimitRetryAt.Store(0)
+	t.Cleanup(func() { redisRateLimitRetryAt.Store(0) })
+	policy := config.RateLimitPolicy{Name: "test", Algorithm: config.RateLimitSlidingWindow, Limit: 5, Period: time.Minute, OnFailure: config.RateLimitFailLocal}
+	ctx := context.Background()
+	// the in-memory counters outlive the test, so every run needs its own key
+	key := "rl:test:recover:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	fake := newFakeRedis(t)
+	useRedis(t, fake.ln.Addr().String())
+	result, err := AllowRequest(ctx, policy, key)
+	if err != nil || !result.Allowed || result.Remaining != 42 {
+		t.Fatalf("Redis result = %+v, %v; want the script's result", result, err)
+	}
+
+	// Nothing listens on a closed listener's port, so dialing fails.
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	deadAddr := dead.Addr().String()
+	dead.Close()
+	useRedis(t, deadAddr)
+	result, err = AllowRequest(ctx, policy, key)
+	if err != nil || !result.Allowed || result.Remaining != policy.Limit-1 {
+		t.Fatalf("fallback result = %+v, %v; want the in-memory result", result, err)
+	}
+	retryAt := redisRateLimitRetryAt.Load()
+	if retryAt <= time.Now().UnixNano() {
+		t.Fatal("a Redis failure did not delay the next Redis attempt")
+	}
+
+	// Redis is back, but is only tried again once the delay is over.
+	useRedis(t, fake.ln.Addr().String())
+	before := fake.evals.Load()
+	if result, _ = AllowRequest(ctx, policy, key); result.Remaining != policy.Limit-2 {
+		t.Fatalf("during the delay result = %+v, want the in-memory result", result)
+	}
+	if fake.evals.Load() != before {
+		t.Fatal("Redis was called during the retry delay")
+	}
+	redisRateLimitRetryAt.Store(time.Now().Add(-time.Second).UnixNano())
+	if result, _ = AllowRequest(ctx, policy, key); result.Remaining != 42 {
+		t.Fatalf("after the delay result = %+v, want the Redis result", result)
+	}
+}
+
+func TestAllowRequestIgnoresContextErrors(t *testing.T) {
+	redisRateLimitRetryAt.Store(0)
+	t.Cleanup(func() { redisRateLimitRetryAt.Store(0) })
+	policy := config.RateLimitPolicy{Name: "test", Algorithm: config.RateLimitTokenBucket, Limit: 5, Period: time.Minute, OnFailure: config.RateLimitFailLocal}
+	useRedis(t, newFakeRedis(t).ln.Addr().String())
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"canceled", canceled},
+		{"deadline exceeded", expired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := AllowRequest(tt.ctx, policy, "rl:test:ctx:"+tt.name); err != nil {
+				t.Fatalf("AllowRequest: %v", err)
+			}
+			if at := redisRateLimitRetryAt.Load(); at != 0 {
+				t.Fatal("a context error delayed the next Redis attempt")
+			}
+		})
+	}
+}
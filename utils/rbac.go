@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"API/config"
+	"API/models"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	rolePermissionsPrefix = "role_permissions:"
+	rolePermissionsTTL    = 5 * time.Minute
+)
+
+// RolePermissions returns the permission names granted to a role. Users
+// without a role are treated as models.RoleUser.
+func RolePermissions(ctx context.Context, roleName string) ([]string, error) {
+	if roleName == "" {
+		roleName = models.RoleUser
+	}
+
+	if config.RedisClient != nil {
+		if data, err := config.RedisClient.Get(ctx, rolePermissionsPrefix+roleName).Result(); err == nil {
+			var perms []string
+			if json.Unmarshal([]byte(data), &perms) == nil {
+				return perms, nil
+			}
+		}
+	}
+
+	var role models.Role
+	if err := config.DB.WithContext(ctx).Preload("Permissions").Where("name = ?", roleName).First(&role).Error; err != nil {
+		return nil, err
+	}
+	perms := make([]string, 0, len(role.Permissions))
+	for _, p := range role.Permissions {
+		perms = append(perms, p.Name)
+	}
+
+	if config.RedisClient != nil {
+		if data, err := json.Marshal(perms); err == nil {
+			config.RedisClient.Set(ctx, rolePermissionsPrefix+roleName, data, rolePermissionsTTL)
+		}
+	}
+	return perms, nil
+}
+
+// InvalidateRolePermissions drops the cached permissions of a role after it changes.
+func InvalidateRolePermissions(ctx context.Context, roleName string) {
+	if config.RedisClient != nil {
+		config.RedisClient.Del(ctx, rolePermissionsPrefix+roleName)
+	}
+}
+
+// HasPermission reports whether required is covered by the granted list,
+// honouring the "*" and "<resource>:*" wildcards.
+func HasPermission(granted []string, required string) bool {
+	resource, _, _ := strings.Cut(required, ":")
+	for _, p := range granted {
+		if p == required || p == models.PermAll || p == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
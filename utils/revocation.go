@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"API/config"
+	"API/models"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm/clause"
+)
+
+const revokedJTIPrefix = "revoked_jti:"
+
+// RevokeJTI adds an access token ID to the denylist until the token expires.
+// The database copy is always written so the denylist survives a Redis
+// restart; Redis is only used to answer IsJTIRevoked quickly.
+func RevokeJTI(ctx context.Context, jti string, userID uint, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+
+	record := models.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt}
+	if err := config.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error; err != nil {
+		return err
+	}
+	// ลบรายการที่หมดอายุแล้วทิ้ง เพื่อไม่ให้ตารางโตไปเรื่อยๆ
+	config.DB.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{})
+
+	if config.RedisClient != nil {
+		if err := config.RedisClient.Set(ctx, revokedJTIPrefix+jti, userID, ttl).Err(); err != nil {
+			log.Printf("WARNING: Failed to cache revoked jti in Redis: %v", err)
+		}
+	}
+	return nil
+}
+
+// IsJTIRevoked reports whether the access token ID is on the denylist. Redis
+// answers when it has the ID cached; on a miss, e.g. after a Redis restart,
+// the database is checked and the answer is cached again.
+func IsJTIRevoked(ctx context.Context, jti string) bool {
+	if jti == "" {
+		return false
+	}
+	return cachedRevocation(ctx, revokedJTIPrefix+jti, func() (bool, time.Duration) {
+		var record models.RevokedToken
+		result := config.DB.WithContext(ctx).Where("jti = ? AND expires_at > ?", jti, time.Now()).Limit(1).Find(&record)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return false, 0
+		}
+		return true, time.Until(record.ExpiresAt)
+	})
+}
+
+// notRevokedMarker is cached for IDs the database says are not revoked, for
+// notRevokedCacheTTL. Revoking overwrites it straight away.
+const (
+	notRevokedMarker   = "0"
+	notRevokedCacheTTL = time.Minute
+)
+
+// cachedRevocation looks key up in Redis and falls back to lookup, the
+// database, when Redis has no answer. The database answer is written back:
+// a revocation for the TTL lookup returns, a "not revoked" marker only with
+// SETNX so it never replaces a revocation written in the meantime.
+func cachedRevocation(ctx context.Context, key string, lookup func() (revoked bool, ttl time.Duration)) bool {
+	if config.RedisClient != nil {
+		value, err := config.RedisClient.Get(ctx, key).Result()
+		if err == nil {
+			return value != notRevokedMarker
+		}
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("WARNING: Redis denylist lookup failed, falling back to database: %v", err)
+		}
+	}
+
+	revoked, ttl := lookup()
+	if config.RedisClient != nil {
+		if revoked && ttl > 0 {
+			config.RedisClient.Set(ctx, key, "1", ttl)
+		} else if !revoked {
+			config.RedisClient.SetNX(ctx, key, notRevokedMarker, notRevokedCacheTTL)
+		}
+	}
+	return revoked
+}
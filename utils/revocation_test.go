@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"API/config"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCachedRevocation(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		redis      bool
+		cached     string // value in Redis before the lookup, "" for none
+		revoked    bool   // what the database says
+		want       bool
+		wantLookup bool
+		wantCached string
+	}{
+		{name: "no redis, revoked", revoked: true, want: true, wantLookup: true},
+		{name: "no redis, not revoked", want: false, wantLookup: true},
+		{name: "cached revocation", redis: true, cached: "1", want: true, wantCached: "1"},
+		{name: "cached not revoked", redis: true, cached: notRevokedMarker, revoked: true, want: false, wantCached: notRevokedMarker},
+		{name: "miss, revoked", redis: true, revoked: true, want: true, wantLookup: true, wantCached: "1"},
+		{name: "miss, not revoked", redis: true, want: false, wantLookup: true, wantCached: notRevokedMarker},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fake *fakeRedis
+			if tt.redis {
+				fake = newFakeRedis(t)
+				useRedis(t, fake.ln.Addr().String())
+				if tt.cached != "" {
+					fake.data["denylist:test"] = tt.cached
+				}
+			} else {
+				previous := config.RedisClient
+				config.RedisClient = nil
+				t.Cleanup(func() { config.RedisClient = previous })
+			}
+
+			looked := false
+			got := cachedRevocation(ctx, "denylist:test", func() (bool, time.Duration) {
+				looked = true
+				return tt.revoked, time.Minute
+			})
+			if got != tt.want {
+				t.Errorf("revoked = %v, want %v", got, tt.want)
+			}
+			if looked != tt.wantLookup {
+				t.Errorf("database lookup = %v, want %v", looked, tt.wantLookup)
+			}
+			if fake != nil {
+				if value, _ := fake.get("denylist:test"); value != tt.wantCached {
+					t.Errorf("cached %q, want %q", value, tt.wantCached)
+				}
+			}
+		})
+	}
+}
+
+func TestCachedRevocationKeepsRevocationOverMarker(t *testing.T) {
+	fake := newFakeRedis(t)
+	useRedis(t, fake.ln.Addr().String())
+
+	// The revocation lands between the database lookup and the write back; the
+	// "not revoked" marker must not replace it.
+	cachedRevocation(context.Background(), "denylist:race", func() (bool, time.Duration) {
+		fake.mu.Lock()
+		fake.data["denylist:race"] = "1"
+		fake.mu.Unlock()
+		return false, 0
+	})
+	if value, _ := fake.get("denylist:race"); value != "1" {
+		t.Fatalf("cached %q, want the revocation", value)
+	}
+}
+
+func TestIsJTIRevokedFromRedis(t *testing.T) {
+	fake := newFakeRedis(t)
+	useRedis(t, fake.ln.Addr().String())
+	fake.data[revokedJTIPrefix+"revoked"] = "42"
+	fake.data[revokedJTIPrefix+"active"] = notRevokedMarker
+
+	tests := []struct {
+		jti  string
+		want bool
+	}{
+		{"", false},
+		{"revoked", true},
+		{"active", false},
+	}
+	for _, tt := range tests {
+		if got := IsJTIRevoked(context.Background(), tt.jti); got != tt.want {
+			t.Errorf("IsJTIRevoked(%q) = %v, want %v", tt.jti, got, tt.want)
+		}
+	}
+}
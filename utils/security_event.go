@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"API/config"
+	"API/models"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecordSecurityEvent stores a security event for the user, taking the IP and
+// user agent from the request. Failures are logged but never fail the request.
+func RecordSecurityEvent(c *gin.Context, userID uint, eventType, detail string) {
+	event := models.SecurityEvent{
+		UserID:    userID,
+		Type:      eventType,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Detail:    detail,
+	}
+	if err := config.DB.WithContext(c.Request.Context()).Create(&event).Error; err != nil {
+		log.Printf("ERROR: Failed to record security event %s for user %d: %v", eventType, userID, err)
+	}
+	log.Printf("SECURITY: %s user=%d ip=%s %s", eventType, userID, event.IP, detail)
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"API/config"
+	"API/models"
+	"context"
+	"time"
+)
+
+const (
+	sessionRevokedPrefix = "session_revoked:"
+	sessionSeenPrefix    = "session_seen:"
+	// sessionRevokedTTL is how long a revocation stays cached in Redis. Once
+	// it expires IsSessionRevoked reads the database again.
+	sessionRevokedTTL  = time.Hour
+	sessionTouchPeriod = time.Minute
+)
+
+// MarkSessionRevoked lets RequireAuth reject the session's access tokens
+// without a database lookup.
+func MarkSessionRevoked(ctx context.Context, sessionID string) {
+	if config.RedisClient != nil {
+		config.RedisClient.Set(ctx, sessionRevokedPrefix+sessionID, "1", sessionRevokedTTL)
+	}
+}
+
+// IsSessionRevoked reports whether the session was revoked. Sessions that do
+// not exist (tokens issued before sessions were tracked) count as active.
+// Redis answers when it has the session cached, otherwise the database does.
+func IsSessionRevoked(ctx context.Context, sessionID string) bool {
+	if sessionID == "" {
+		return false
+	}
+	return cachedRevocation(ctx, sessionRevokedPrefix+sessionID, func() (bool, time.Duration) {
+		var count int64
+		config.DB.WithContext(ctx).Model(&models.Session{}).
+			Where("id = ? AND revoked_at IS NOT NULL", sessionID).Count(&count)
+		return count > 0, sessionRevokedTTL
+	})
+}
+
+// TouchSession updates last_seen_at at most once per sessionTouchPeriod.
+func TouchSession(ctx context.Context, sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	if config.RedisClient != nil {
+		ok, err := config.RedisClient.SetNX(ctx, sessionSeenPrefix+sessionID, "1", sessionTouchPeriod).Result()
+		if err == nil && !ok {
+			return
+		}
+	}
+	now := time.Now()
+	config.DB.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND last_seen_at < ?", sessionID, now.Add(-sessionTouchPeriod)).
+		Update("last_seen_at", now)
+}